@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"unicode/utf8"
+)
+
+// Badges may be cached this long by browsers and wiki proxies
+const BADGE_MAX_AGE_SECONDS = 300
+
+// Badge colours, as used by shields.io
+const (
+	BadgeGreen  = "#4c1"
+	BadgeYellow = "#dfb317"
+	BadgeRed    = "#e05d44"
+	BadgeGrey   = "#9f9f9f"
+	BadgeLabel  = "#555"
+)
+
+type badge struct {
+	Label   string
+	Message string
+	Color   string
+}
+
+// Describe the state of a test run report as a badge: certified once complete with every test
+// case passed, otherwise how many test cases are passing
+func badgeForReport(testRunReport TestRunReport) badge {
+
+	b := badge{Label: "dstest"}
+	if testRunReport.TestSuite != nil && testRunReport.TestSuite.Name != "" {
+		b.Label = testRunReport.TestSuite.Name
+	}
+
+	passed, total := testRunReport.NumTestsPassed, testRunReport.NumTestCases
+	failed := testRunReport.NumTestsAttempted - passed
+
+	switch {
+	case testRunReport.Status == Complete && total > 0 && passed == total:
+		b.Message, b.Color = "certified", BadgeGreen
+	case testRunReport.Status == Cancelled:
+		b.Message, b.Color = "cancelled", BadgeGrey
+	case testRunReport.NumTestsAttempted == 0 && testRunReport.Status != Expired:
+		b.Message, b.Color = "not started", BadgeGrey
+	default:
+		b.Message = fmt.Sprintf("%d/%d passing", passed, total)
+		switch {
+		case failed > 0 || testRunReport.Status == Expired:
+			b.Color = BadgeRed
+		case passed == total:
+			b.Color = BadgeGreen
+		default:
+			b.Color = BadgeYellow
+		}
+	}
+
+	return b
+}
+
+// Rough width of text in 11px Verdana, which is close enough to size the badge
+func badgeTextWidth(text string) int {
+	return utf8.RuneCountInString(text)*7 + 10
+}
+
+// Render the badge as a flat shields-style SVG
+func renderBadge(b badge) string {
+
+	label := html.EscapeString(b.Label)
+	message := html.EscapeString(b.Message)
+
+	labelWidth := badgeTextWidth(b.Label)
+	messageWidth := badgeTextWidth(b.Message)
+	width := labelWidth + messageWidth
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[2]s: %[3]s">
+<title>%[2]s: %[3]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+<rect width="%[4]d" height="20" fill="%[6]s"/>
+<rect x="%[4]d" width="%[5]d" height="20" fill="%[7]s"/>
+<rect width="%[1]d" height="20" fill="url(#s)"/>
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[8]d" y="15" fill="#010101" fill-opacity=".3">%[2]s</text>
+<text x="%[8]d" y="14">%[2]s</text>
+<text x="%[9]d" y="15" fill="#010101" fill-opacity=".3">%[3]s</text>
+<text x="%[9]d" y="14">%[3]s</text>
+</g>
+</svg>
+`, width, label, message, labelWidth, messageWidth, BadgeLabel, b.Color, labelWidth/2, labelWidth+messageWidth/2)
+}
+
+// Write the badge with cache headers, answering conditional requests for an unchanged badge
+// with 304 Not Modified
+func writeBadge(b badge, w http.ResponseWriter, r *http.Request) {
+
+	svg := renderBadge(b)
+
+	sum := sha256.Sum256([]byte(svg))
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", BADGE_MAX_AGE_SECONDS))
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Write([]byte(svg))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Shown for runs and suites that can't be found, so embedded images don't break
+var unknownBadge = badge{Label: "dstest", Message: "unknown", Color: BadgeGrey}
+
+// GET /dstestapi/badges/testruns/{id}.svg handler
+func getTestRunBadge(w http.ResponseWriter, r *http.Request) {
+
+	// we get params with mux.
+	var params = mux.Vars(r)
+
+	writeTestRunBadge(params["id"], w, r)
+}
+
+// GET /dstestapi/badges/apikeys/{apikey}/suites/{suiteId}.svg handler
+// Reflects the most recent test run of the suite for the API key
+func getApiKeySuiteBadge(w http.ResponseWriter, r *http.Request) {
+
+	// we get params with mux.
+	var params = mux.Vars(r)
+
+	// string to primitive.ObjectID
+	suiteId, _ := primitive.ObjectIDFromHex(params["suiteId"])
+
+	filter := bson.M{"apikey": params["apikey"], "testsuite._id": suiteId}
+	findOptions := options.FindOne().SetSort(bson.M{"_id": -1})
+
+	var testRun TestRun
+	err := testrunCollection.FindOne(ctx, filter, findOptions).Decode(&testRun)
+
+	if err != nil {
+		writeBadge(unknownBadge, w, r)
+		return
+	}
+
+	writeTestRunBadge(testRun.Id.Hex(), w, r)
+}
+
+func writeTestRunBadge(testRunId string, w http.ResponseWriter, r *http.Request) {
+
+	testRun, err := fetchTestRun(testRunId)
+
+	if err != nil {
+		writeBadge(unknownBadge, w, r)
+		return
+	}
+
+	testRunReport, err := compileTestRunReport(testRun)
+
+	if err != nil {
+		writeBadge(unknownBadge, w, r)
+		return
+	}
+
+	writeBadge(badgeForReport(testRunReport), w, r)
+}
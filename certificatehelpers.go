@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Environment variable holding the base64 encoded Ed25519 seed (32 bytes) or private key (64 bytes)
+const SIGNING_KEY_ENV = "DSTEST_SIGNING_KEY"
+
+const CERTIFICATE_ALGORITHM = "Ed25519"
+
+// The key certificates are signed with; nil when none is configured
+var signingKey ed25519.PrivateKey
+
+// Parse the configured signing key. An empty value means certification is disabled.
+func loadSigningKey(encoded string) (ed25519.PrivateKey, error) {
+
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not valid base64: %s", SIGNING_KEY_ENV, err.Error())
+	}
+
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	}
+
+	return nil, fmt.Errorf("%s must be a %d byte seed or a %d byte private key", SIGNING_KEY_ENV, ed25519.SeedSize, ed25519.PrivateKeySize)
+}
+
+// Identifies the key a certificate was signed with: the first 8 bytes of the SHA-256 of the public key
+func signingKeyId(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+func signingPublicKey() (ed25519.PublicKey, error) {
+	if signingKey == nil {
+		return nil, NewErrorResponse(http.StatusServiceUnavailable, "certificate signing is not configured")
+	}
+	return signingKey.Public().(ed25519.PublicKey), nil
+}
+
+// Check whether every test case in the run passed, optional ones included
+func allTestsPassed(testRun TestRun) bool {
+
+	if len(testRun.TestResults) == 0 {
+		return false
+	}
+
+	for _, testResult := range testRun.TestResults {
+		if testResult.Status != Success {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Identifies what a certificate attests to: the run, the version of its suite and the
+// transaction that passed each test case
+func testRunResultsDigest(testRun TestRun) string {
+
+	var lines []string
+	for _, testResult := range testRun.TestResults {
+		transactionId := ""
+		if testResult.Transaction != nil {
+			transactionId = testResult.Transaction.Id.Hex()
+		}
+		lines = append(lines, testResult.TestCase.Id.Hex()+":"+transactionId)
+	}
+	sort.Strings(lines)
+
+	digest := sha256.New()
+	fmt.Fprintf(digest, "run:%s\n", testRun.Id.Hex())
+	if testRun.TestSuite != nil {
+		fmt.Fprintf(digest, "suite:%s:%d\n", testRun.TestSuite.Id.Hex(), testRun.TestSuite.Version)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(digest, "%s\n", line)
+	}
+
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// Sign and store a certificate for a test run that passed every test case. A run is certified
+// once for each version of its suite and set of passing transactions; asking again returns the
+// certificate already issued.
+func issueCertificate(testRun TestRun) (Certificate, error) {
+
+	publicKey, err := signingPublicKey()
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	claims := CertificateClaims{
+		TestRunId:      testRun.Id,
+		TestRunName:    testRun.Name,
+		ApiKey:         testRun.ApiKey,
+		NumTestCases:   len(testRun.TestResults),
+		NumTestsPassed: len(testRun.TestResults),
+		ResultsDigest:  testRunResultsDigest(testRun),
+		IssuedAt:       time.Now().UTC().Truncate(time.Millisecond),
+	}
+	if testRun.TestSuite != nil {
+		claims.TestSuiteId = testRun.TestSuite.Id
+		claims.TestSuiteName = testRun.TestSuite.Name
+		claims.TestSuiteVersion = testRun.TestSuite.Version
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	certificate := Certificate{
+		Id:        primitive.NewObjectID(),
+		Claims:    claims,
+		Payload:   base64.RawURLEncoding.EncodeToString(payload),
+		Algorithm: CERTIFICATE_ALGORITHM,
+		KeyId:     signingKeyId(publicKey),
+	}
+	certificate.Signature = base64.RawURLEncoding.EncodeToString(ed25519.Sign(signingKey, []byte(certificate.Payload)))
+
+	// Only insert the certificate if none has been issued for these results
+	filter := bson.M{"claims.resultsdigest": claims.ResultsDigest}
+	update := bson.M{"$setOnInsert": certificate}
+	updateOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var issued Certificate
+	err = certificateCollection.FindOneAndUpdate(ctx, filter, update, updateOptions).Decode(&issued)
+
+	return issued, err
+}
+
+// Check a certificate's signature against the configured key, and that its claims are the
+// ones that were signed
+func verifyCertificate(certificate Certificate) (CertificateVerification, error) {
+
+	publicKey, err := signingPublicKey()
+	if err != nil {
+		return CertificateVerification{}, err
+	}
+
+	invalid := func(reason string) (CertificateVerification, error) {
+		return CertificateVerification{Valid: false, Reason: reason}, nil
+	}
+
+	if certificate.Algorithm != CERTIFICATE_ALGORITHM {
+		return invalid("unsupported algorithm " + certificate.Algorithm)
+	}
+	if certificate.KeyId != signingKeyId(publicKey) {
+		return invalid("certificate was not signed with this service's key")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(certificate.Signature)
+	if err != nil || !ed25519.Verify(publicKey, []byte(certificate.Payload), signature) {
+		return invalid("signature does not match payload")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(certificate.Payload)
+	if err != nil {
+		return invalid("payload is not valid base64url")
+	}
+
+	var claims CertificateClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return invalid("payload is not a valid set of claims")
+	}
+
+	// Claims presented alongside the payload must be the ones that were signed
+	if certificate.Claims != (CertificateClaims{}) {
+		presented, _ := json.Marshal(certificate.Claims)
+		signed, _ := json.Marshal(claims)
+		if string(presented) != string(signed) {
+			return invalid("claims do not match the signed payload")
+		}
+	}
+
+	return CertificateVerification{Valid: true, Claims: &claims}, nil
+}
+
+// Fetch the most recently issued certificate for the test run
+func fetchTestRunCertificate(testRunId string) (Certificate, error) {
+
+	var certificate Certificate
+
+	id, err := primitive.ObjectIDFromHex(testRunId)
+	if err != nil {
+		return certificate, errors.New("invalid test run id")
+	}
+
+	findOptions := options.FindOne().SetSort(bson.M{"_id": -1})
+	err = certificateCollection.FindOne(ctx, bson.M{"claims.testrunid": id}, findOptions).Decode(&certificate)
+
+	return certificate, err
+}
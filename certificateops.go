@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GET /dstestapi/testruns/{id}/certificate handler
+// Returns the latest certificate issued for the test run
+func getTestRunCertificate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// we get params with mux.
+	var params = mux.Vars(r)
+
+	certificate, err := fetchTestRunCertificate(params["id"])
+
+	if err != nil {
+		//TODO assumption here is that the error is `not found`
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(certificate)
+}
+
+// GET /dstestapi/certificates/{id} handler
+func getCertificate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// we get params with mux.
+	var params = mux.Vars(r)
+
+	// string to primitive.ObjectID
+	id, _ := primitive.ObjectIDFromHex(params["id"])
+
+	var certificate Certificate
+	err := certificateCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&certificate)
+
+	if err != nil {
+		//TODO assumption here is that the error is `not found`
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(certificate)
+}
+
+// POST /dstestapi/certificates/verify handler
+// Checks a certificate, as returned by the certificate endpoints, against this service's key
+func verifyCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var certificate Certificate
+
+	if err := json.NewDecoder(r.Body).Decode(&certificate); err != nil {
+		SendError(NewErrorResponse(http.StatusBadRequest, "body must be a certificate"), w)
+		return
+	}
+
+	verification, err := verifyCertificate(certificate)
+
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(verification)
+}
+
+// GET /dstestapi/certificates/publickey handler
+// Publishes the public half of the signing key so certificates can be verified offline
+func getCertificatePublicKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	publicKey, err := signingPublicKey()
+
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(CertificatePublicKey{
+		Algorithm: CERTIFICATE_ALGORITHM,
+		KeyId:     signingKeyId(publicKey),
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+	})
+}
@@ -5,6 +5,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // Deep load of all test cases in the supplied test suite
@@ -68,9 +69,43 @@ func loadPredicates(testCase TestCase, ctx context.Context) (TestCase, error) {
 
 	// Replace the Predicates array on the testCase with the fully resolved array
 	testCase.Predicates = predicates
+
+	if testCase.PredicateGroup != nil {
+		if err := loadPredicateGroup(testCase.PredicateGroup, ctx); err != nil {
+			return testCase, err
+		}
+	}
+
 	return testCase, nil
 }
 
+// Deep load of all predicates in the supplied predicate group and its nested groups
+func loadPredicateGroup(group *PredicateGroup, ctx context.Context) error {
+
+	var predicates []*TestCasePredicate
+
+	for _, predicate := range group.Predicates {
+
+		predicate, err := getPredicateById(predicate.Id, ctx)
+
+		if err == nil {
+			predicates = append(predicates, &predicate)
+		} else {
+			return err
+		}
+	}
+
+	group.Predicates = predicates
+
+	for _, nestedGroup := range group.Groups {
+		if err := loadPredicateGroup(nestedGroup, ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Fetch the Predicate with the specified id
 func getPredicateById(id primitive.ObjectID, ctx context.Context) (TestCasePredicate, error) {
 	// filter := bson.D{{"_id", bson.D{{"$eq", id}}}}
@@ -86,11 +121,86 @@ func getPredicateById(id primitive.ObjectID, ctx context.Context) (TestCasePredi
 	}
 }
 
+// Suites hold their own copies of their test cases, so bring the copies held by every suite that
+// uses the predicate up to date with it, advancing the version of each of those suites
+func refreshTestSuitesUsingPredicate(predicateId primitive.ObjectID, ctx context.Context) error {
+
+	cursor, err := testsuiteCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+
+	var testSuites []TestSuite
+	if err = cursor.All(ctx, &testSuites); err != nil {
+		return err
+	}
+
+	for _, testSuite := range testSuites {
+
+		if !testSuiteUsesPredicate(testSuite, predicateId) {
+			continue
+		}
+
+		testSuite, err = loadTestCases(testSuite, ctx)
+		if err != nil {
+			return err
+		}
+
+		update := bson.M{
+			"$set": bson.M{"testcases": testSuite.TestCases},
+			"$inc": bson.M{"version": 1},
+		}
+		if _, err = testsuiteCollection.UpdateOne(ctx, bson.M{"_id": testSuite.Id}, update); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func testSuiteUsesPredicate(testSuite TestSuite, predicateId primitive.ObjectID) bool {
+
+	for _, testCase := range testSuite.TestCases {
+		for _, predicate := range testCase.Predicates {
+			if predicate.Id == predicateId {
+				return true
+			}
+		}
+		if testCase.PredicateGroup != nil && predicateGroupUsesPredicate(testCase.PredicateGroup, predicateId) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func predicateGroupUsesPredicate(group *PredicateGroup, predicateId primitive.ObjectID) bool {
+
+	for _, predicate := range group.Predicates {
+		if predicate.Id == predicateId {
+			return true
+		}
+	}
+
+	for _, nestedGroup := range group.Groups {
+		if predicateGroupUsesPredicate(nestedGroup, predicateId) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Load and attach the TestSuite associated with the supplied (and returned) TestRun
+// Runs created without a test suite have nothing to load, and are reported as not found.
 func loadTestSuite(testrun TestRun, ctx context.Context) (TestRun, error) {
 
 	var testsuite TestSuite
 
+	if testrun.TestSuite == nil {
+		return testrun, mongo.ErrNoDocuments
+	}
+
 	filter := bson.M{"_id": testrun.TestSuite.Id}
 	err := testsuiteCollection.FindOne(ctx, filter).Decode(&testsuite)
 
@@ -101,3 +211,18 @@ func loadTestSuite(testrun TestRun, ctx context.Context) (TestRun, error) {
 		return testrun, nil
 	}
 }
+
+// Fetch the TestRun that transactions reference via the supplied test run header id
+func getTestRunByHeaderId(headerId string, ctx context.Context) (TestRun, error) {
+
+	var testrun TestRun
+
+	filter := bson.M{"testrunheaderid": headerId}
+	err := testrunCollection.FindOne(ctx, filter).Decode(&testrun)
+
+	if err != nil {
+		return testrun, err
+	} else {
+		return testrun, nil
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Only the suites that use an updated predicate, however deeply, get a new copy and version
+func TestRefreshTestSuitesUsingPredicate(t *testing.T) {
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("refresh", func(mt *mtest.T) {
+		testsuiteCollection = mt.Coll
+		testcaseCollection = mt.Coll
+		predicateCollection = mt.Coll
+
+		predicate := TestCasePredicate{Id: primitive.NewObjectID(), Attribute: "card.brand", Operator: OpEquals, ExpectedValue: "VISA"}
+		group := &PredicateGroup{Operator: GroupOr, Groups: []*PredicateGroup{{Operator: GroupAnd, Predicates: []*TestCasePredicate{&predicate}}}}
+		testCase := TestCase{Id: primitive.NewObjectID(), Name: "Pay by card", Url: "/payments", ExpectedStatus: "201", PredicateGroup: group}
+
+		using := TestSuite{Id: primitive.NewObjectID(), Name: "Cards", Version: 2, TestCases: []*TestCase{&testCase}}
+		other := TestSuite{Id: primitive.NewObjectID(), Name: "Refunds", Version: 1, TestCases: []*TestCase{{Id: primitive.NewObjectID()}}}
+
+		addDocumentsResponse(mt, using, other)
+		addDocumentsResponse(mt, testCase)
+		predicate.ExpectedValue = "MASTERCARD"
+		addDocumentsResponse(mt, predicate)
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"n", 1}, {"nModified", 1}})
+
+		if err := refreshTestSuitesUsingPredicate(predicate.Id, ctx); err != nil {
+			mt.Fatal(err)
+		}
+
+		var updates []bson.Raw
+		for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+			if event.CommandName == "update" {
+				updates = append(updates, event.Command)
+			}
+		}
+		if len(updates) != 1 {
+			mt.Fatalf("%d suites were updated, want 1", len(updates))
+		}
+
+		update := updates[0].Lookup("updates").Array().Index(0).Value().Document()
+		if id := update.Lookup("q", "_id").ObjectID(); id != using.Id {
+			mt.Fatalf("updated suite %s, want %s", id.Hex(), using.Id.Hex())
+		}
+		if inc := update.Lookup("u", "$inc", "version").Int32(); inc != 1 {
+			mt.Fatalf("version is incremented by %d, want 1", inc)
+		}
+
+		refreshed := update.Lookup("u", "$set", "testcases").Array().Index(0).Value().Document()
+		expected := refreshed.Lookup("predicategroup", "groups").Array().Index(0).Value().Document().
+			Lookup("predicates").Array().Index(0).Value().Document().Lookup("expectedvalue").StringValue()
+		if expected != "MASTERCARD" {
+			mt.Fatalf("suite holds expected value %q, want the updated MASTERCARD", expected)
+		}
+	})
+}
@@ -24,6 +24,10 @@ var predicateCollection *mongo.Collection
 var testcaseCollection *mongo.Collection
 var testsuiteCollection *mongo.Collection
 var testrunCollection *mongo.Collection
+var evaluationCollection *mongo.Collection
+var webhookCollection *mongo.Collection
+var webhookDeliveryCollection *mongo.Collection
+var certificateCollection *mongo.Collection
 
 // const DB_CONNECTION_STRING = "mongodb://localhost:27017"
 
@@ -56,6 +60,7 @@ func main() {
 	r.HandleFunc("/dstestapi/testcases/{id}", deleteTestCase).Methods("DELETE")
 
 	// /destestapi/testsuites
+	r.HandleFunc("/dstestapi/testsuites", createTestSuiteFromText).Methods("POST").HeadersRegexp("Content-Type", "^text/plain")
 	r.HandleFunc("/dstestapi/testsuites", createTestSuite).Methods("POST")
 	r.HandleFunc("/dstestapi/testsuites", getTestSuites).Methods("GET")
 	r.HandleFunc("/dstestapi/testsuites/{id}", getTestSuite).Methods("GET")
@@ -67,8 +72,37 @@ func main() {
 	r.HandleFunc("/dstestapi/testruns", getTestRuns).Methods("GET")
 	r.HandleFunc("/dstestapi/testruns/{id}", getTestRun).Methods("GET")
 	r.HandleFunc("/dstestapi/testruns/{id}/report", getTestRunReport).Methods("GET")
+	r.HandleFunc("/dstestapi/testruns/{id}/evaluate", evaluateTestRunHandler).Methods("POST")
+	r.HandleFunc("/dstestapi/testruns/{id}/evaluations", getTestRunEvaluations).Methods("GET")
+	r.HandleFunc("/dstestapi/testruns/{id}/testcases/{caseId}/explain", getTestCaseExplanation).Methods("GET")
+	r.HandleFunc("/dstestapi/testruns/{id}/unmatched", getUnmatchedTransactions).Methods("GET")
+	r.HandleFunc("/dstestapi/testruns/{id}/events", getTestRunEvents).Methods("GET")
 	r.HandleFunc("/dstestapi/testruns/{id}", deleteTestRun).Methods("DELETE")
-	// r.HandleFunc("/dstestapi/testruns/{id}/stop", stopTestRun).Methods("POST")
+	r.HandleFunc("/dstestapi/testruns/{id}/stop", stopTestRun).Methods("POST")
+	r.HandleFunc("/dstestapi/testruns/{id}/cancel", cancelTestRun).Methods("POST")
+	r.HandleFunc("/dstestapi/testruns/{id}/reopen", reopenTestRun).Methods("POST")
+
+	// /destestapi/transactions
+	r.HandleFunc("/dstestapi/transactions", createTransactions).Methods("POST")
+	r.HandleFunc("/dstestapi/transactions/import", importTransactions).Methods("POST")
+
+	// /destestapi/webhooks
+	r.HandleFunc("/dstestapi/webhooks", createWebhook).Methods("POST")
+	r.HandleFunc("/dstestapi/webhooks", getWebhooks).Methods("GET")
+	r.HandleFunc("/dstestapi/webhooks/{id}", getWebhook).Methods("GET")
+	r.HandleFunc("/dstestapi/webhooks/{id}", deleteWebhook).Methods("DELETE")
+	r.HandleFunc("/dstestapi/webhooks/{id}/deliveries", getWebhookDeliveries).Methods("GET")
+	r.HandleFunc("/dstestapi/webhooks/deliveries/{id}/replay", replayWebhookDelivery).Methods("POST")
+
+	// /destestapi/certificates
+	r.HandleFunc("/dstestapi/testruns/{id}/certificate", getTestRunCertificate).Methods("GET")
+	r.HandleFunc("/dstestapi/certificates/publickey", getCertificatePublicKey).Methods("GET")
+	r.HandleFunc("/dstestapi/certificates/verify", verifyCertificateHandler).Methods("POST")
+	r.HandleFunc("/dstestapi/certificates/{id}", getCertificate).Methods("GET")
+
+	// /destestapi/badges
+	r.HandleFunc("/dstestapi/badges/testruns/{id:[0-9a-fA-F]+}.svg", getTestRunBadge).Methods("GET")
+	r.HandleFunc("/dstestapi/badges/apikeys/{apikey}/suites/{suiteId:[0-9a-fA-F]+}.svg", getApiKeySuiteBadge).Methods("GET")
 
 	// Health check endpoint
 	r.HandleFunc("/", healthCheck).Methods("GET")
@@ -101,15 +135,43 @@ func main() {
 	testcaseCollection = db.Collection("testcases")
 	testsuiteCollection = db.Collection("testsuites")
 	testrunCollection = db.Collection("testruns")
+	evaluationCollection = db.Collection("evaluations")
+	webhookCollection = db.Collection("webhooks")
+	webhookDeliveryCollection = db.Collection("webhookdeliveries")
+	certificateCollection = db.Collection("certificates")
 
 	fmt.Println("Initialized db and collections")
 
+	// Certificates are only issued when a signing key is configured
+	signingKey, err = loadSigningKey(os.Getenv(SIGNING_KEY_ENV))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if signingKey == nil {
+		fmt.Println(SIGNING_KEY_ENV, "not set, certificates will not be issued")
+	}
+
+	// Keep the results of active test runs up to date in the background
+	go startEvaluationWorker()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "5000"
 		fmt.Printf("defaulting to port %s\n", port)
 	}
 
+	// Optionally run a recording reverse proxy in front of a target API
+	proxyTarget := os.Getenv("PROXY_TARGET")
+	if proxyTarget != "" {
+		proxyPort := os.Getenv("PROXY_PORT")
+		if proxyPort == "" {
+			proxyPort = "5001"
+			fmt.Printf("defaulting to proxy port %s\n", proxyPort)
+		}
+
+		go startRecordingProxy(proxyTarget, proxyPort)
+	}
+
 	fmt.Println("Listening on port", port)
 
 	// set our listen port address
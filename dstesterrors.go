@@ -30,3 +30,32 @@ func GetError(err error, w http.ResponseWriter) {
 	w.WriteHeader(response.StatusCode)
 	w.Write(message)
 }
+
+// Error : Allows an ErrorResponse to be returned as an error from helpers.
+func (e ErrorResponse) Error() string {
+	return e.ErrorMessage
+}
+
+// NewErrorResponse : This is helper function to build an error model with a specific status code.
+func NewErrorResponse(statusCode int, message string) ErrorResponse {
+	return ErrorResponse{StatusCode: statusCode, ErrorMessage: message}
+}
+
+// SendError : This is helper function to write an error model without terminating the server.
+// Errors that are not an ErrorResponse are reported as internal server errors.
+func SendError(err error, w http.ResponseWriter) {
+
+	response, ok := err.(ErrorResponse)
+	if !ok {
+		log.Println(err.Error())
+		response = ErrorResponse{
+			ErrorMessage: err.Error(),
+			StatusCode:   http.StatusInternalServerError,
+		}
+	}
+
+	message, _ := json.Marshal(response)
+
+	w.WriteHeader(response.StatusCode)
+	w.Write(message)
+}
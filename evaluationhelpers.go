@@ -0,0 +1,92 @@
+package main
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Compile the report for an evaluated test run and store it as a new evaluation
+func storeTestRunEvaluation(testRun TestRun) (TestRunEvaluation, error) {
+
+	testRunReport, err := compileTestRunReport(testRun)
+	if err != nil {
+		return TestRunEvaluation{}, err
+	}
+
+	evaluation := TestRunEvaluation{TestRunId: testRun.Id, Report: &testRunReport, Timestamp: time.Now()}
+
+	result, err := evaluationCollection.InsertOne(ctx, evaluation)
+	if err != nil {
+		return TestRunEvaluation{}, err
+	}
+
+	evaluation.Id = result.InsertedID.(primitive.ObjectID)
+	evaluation.Report.EvaluationId = evaluation.Id
+
+	return evaluation, nil
+}
+
+// Fetch the specified evaluation of the test run, or the latest one if evaluationId is empty
+func fetchTestRunEvaluation(testRunId string, evaluationId string) (TestRunEvaluation, error) {
+
+	var evaluation TestRunEvaluation
+
+	// string to primitive.ObjectID
+	runId, _ := primitive.ObjectIDFromHex(testRunId)
+
+	filter := bson.M{"testrunid": runId}
+	findOptions := options.FindOne()
+
+	if evaluationId != "" {
+		id, _ := primitive.ObjectIDFromHex(evaluationId)
+		filter["_id"] = id
+	} else {
+		// Most recent first
+		findOptions.SetSort(bson.M{"_id": -1})
+	}
+
+	err := evaluationCollection.FindOne(ctx, filter, findOptions).Decode(&evaluation)
+	if err != nil {
+		return TestRunEvaluation{}, err
+	}
+
+	if evaluation.Report == nil {
+		evaluation.Report = &TestRunReport{}
+	}
+	evaluation.Report.EvaluationId = evaluation.Id
+
+	return evaluation, nil
+}
+
+// Fetch every evaluation of the test run, most recent first, without their full test run snapshots
+func fetchTestRunEvaluations(testRunId string) ([]TestRunEvaluation, error) {
+
+	// string to primitive.ObjectID
+	runId, _ := primitive.ObjectIDFromHex(testRunId)
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.M{"_id": -1})
+	findOptions.SetProjection(bson.M{"report.testrun": 0, "report.testsuite": 0})
+
+	cursor, err := evaluationCollection.Find(ctx, bson.M{"testrunid": runId}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluations := []TestRunEvaluation{}
+	if err = cursor.All(ctx, &evaluations); err != nil {
+		return nil, err
+	}
+
+	for i := range evaluations {
+		if evaluations[i].Report == nil {
+			evaluations[i].Report = &TestRunReport{}
+		}
+		evaluations[i].Report.EvaluationId = evaluations[i].Id
+	}
+
+	return evaluations, nil
+}
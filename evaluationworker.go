@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// How often active test runs are checked for new transactions and expiry
+const WORKER_POLL_INTERVAL = 10 * time.Second
+
+// Keep the results of active test runs up to date as transactions arrive. Inserts are picked up
+// immediately from a change stream where the deployment supports one; every active run is also
+// polled periodically, which covers deployments without change streams and runs that expire.
+func startEvaluationWorker() {
+
+	go watchTransactions()
+
+	for {
+		pollActiveTestRuns()
+		time.Sleep(WORKER_POLL_INTERVAL)
+	}
+}
+
+// Refresh test runs as soon as transactions are inserted for them.
+// Returns if change streams are not available, leaving polling to do the work.
+func watchTransactions() {
+
+	pipeline := mongo.Pipeline{bson.D{{Key: "$match", Value: bson.M{"operationType": "insert"}}}}
+
+	stream, err := txCollection.Watch(context.Background(), pipeline)
+	if err != nil {
+		fmt.Println("Change streams unavailable, polling for transactions:", err.Error())
+		return
+	}
+	defer stream.Close(context.Background())
+
+	fmt.Println("Watching for transactions")
+
+	for stream.Next(context.Background()) {
+
+		var event struct {
+			Transaction Transaction `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			log.Println("Could not decode transaction event:", err.Error())
+			continue
+		}
+
+		testRun, err := getTestRunByHeaderId(event.Transaction.TestRunId, ctx)
+		if err != nil {
+			continue // not a transaction for a known test run
+		}
+
+		refreshTestRun(testRun)
+	}
+
+	if err := stream.Err(); err != nil {
+		fmt.Println("Change stream closed, polling for transactions:", err.Error())
+	}
+}
+
+// Refresh every test run that has not yet finished
+func pollActiveTestRuns() {
+
+	filter := bson.M{"status": bson.M{"$in": bson.A{UndefinedRunStatus, Created, InProgress}}}
+
+	cursor, err := testrunCollection.Find(ctx, filter)
+	if err != nil {
+		log.Println("Could not find active test runs:", err.Error())
+		return
+	}
+
+	var testRuns []TestRun
+	if err = cursor.All(ctx, &testRuns); err != nil {
+		log.Println("Could not load active test runs:", err.Error())
+		return
+	}
+
+	for _, testRun := range testRuns {
+		refreshTestRun(testRun)
+	}
+}
+
+// Bring the results of a single test run up to date and persist them if anything changed,
+// storing a new evaluation so the report reflects them too.
+// Losing a race with another writer is not an error: the next refresh will pick up the changes.
+// A panic is logged and contained so that one bad document cannot stop the worker.
+func refreshTestRun(testRun TestRun) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("Recovered from panic refreshing test run", testRun.Id.Hex(), ":", r)
+		}
+	}()
+
+	if isTerminal(testRun.Status) || testRun.TestSuite == nil {
+		return
+	}
+
+	testRun, err := loadTestSuite(testRun, ctx)
+	if err != nil {
+		log.Println("Could not load test suite for test run", testRun.Id.Hex(), ":", err.Error())
+		return
+	}
+
+	before := snapshotTestRun(testRun)
+
+	changed, err := applyNewTransactions(&testRun)
+	if err == nil && changed {
+		err = saveTestRunChanges(before, &testRun)
+		if err == nil {
+			_, err = storeTestRunEvaluation(testRun)
+		}
+	}
+
+	if _, conflict := err.(ErrorResponse); err != nil && !conflict {
+		log.Println("Could not refresh test run", testRun.Id.Hex(), ":", err.Error())
+	}
+}
+
+// Update the run's results with the transactions that arrived since it was last evaluated,
+// without re-scanning the transactions already taken into account. Reports whether the run changed.
+func applyNewTransactions(testRun *TestRun) (bool, error) {
+
+	transactions, err := findUnseenTransactions(*testRun)
+	if err != nil {
+		return false, err
+	}
+
+	// A run that has never been evaluated, or whose results no longer line up with its suite,
+	// is matched from scratch
+	if len(testRun.TestResults) != len(testRun.TestSuite.TestCases) {
+		if !testRun.LastTransactionId.IsZero() {
+			transactions, err = findTransactionsForTestRun(*testRun)
+			if err != nil {
+				return false, err
+			}
+		}
+		return true, matchTransactionsToTestRun(testRun, transactions)
+	}
+
+	return mergeNewTransactions(testRun, transactions), nil
+}
+
+// Fold transactions the run has not yet seen into its results and move it along its lifecycle.
+// Reports whether the run changed.
+func mergeNewTransactions(testRun *TestRun, transactions []Transaction) bool {
+
+	previousStatus := testRun.Status
+
+	if len(transactions) > 0 {
+		for _, testResult := range testRun.TestResults {
+			mergeTransactionsIntoResult(testResult, transactions, testRun.Timestamp)
+		}
+
+		testRun.UnmatchedTransactions = mergeUnmatchedTransactions(testRun.UnmatchedTransactions,
+			findUnmatchedTransactions(testRun.TestSuite, transactions))
+
+		recordSeenTransactions(testRun, transactions)
+		testRun.Reopened = false
+	}
+
+	testRun.Status = nextTestRunStatus(*testRun, time.Now())
+
+	return len(transactions) > 0 || testRun.Status != previousStatus
+}
+
+// Fold newly arrived transactions into an existing test result, keeping the same choice of
+// matching transaction that a full evaluation would make: the most recent success, otherwise
+// the oldest failure
+func mergeTransactionsIntoResult(testResult *TestResult, transactions []Transaction, testRunStarted time.Time) {
+
+	transaction, testStatus, attempts, _ := matchTransactionToTestCase(*testResult.TestCase, transactions)
+
+	// A transaction that was stored late can be older than the one already matched
+	replace := false
+	switch testStatus {
+	case Success:
+		replace = testResult.Status != Success || transaction.Id.Hex() > matchedTransactionId(testResult)
+	case Failure:
+		replace = testResult.Status != Success &&
+			(testResult.Status != Failure || transaction.Id.Hex() < matchedTransactionId(testResult))
+	}
+
+	if replace {
+		testResult.Status = testStatus
+		testResult.Transaction = &transaction
+		testResult.Timestamp = time.Now()
+	}
+
+	// Attempts are recorded oldest first, and late transactions can belong among those already recorded
+	attempts = append(testResult.Attempts, attempts...)
+	sort.SliceStable(attempts, func(i, j int) bool {
+		return attempts[i].TransactionId.Hex() < attempts[j].TransactionId.Hex()
+	})
+	summarizeAttempts(testResult, attempts, testRunStarted)
+
+	if testResult.Status == NotAttempted {
+		nearMisses := append(testResult.NearMisses, findNearMisses(*testResult.TestCase, transactions)...)
+
+		// Most recent first, then best first, as findNearMisses ranks them
+		sort.SliceStable(nearMisses, func(i, j int) bool {
+			return nearMisses[i].TransactionId.Hex() > nearMisses[j].TransactionId.Hex()
+		})
+		sort.SliceStable(nearMisses, func(i, j int) bool {
+			return nearMisses[i].Score > nearMisses[j].Score
+		})
+
+		if len(nearMisses) > NEAR_MISS_LIMIT {
+			nearMisses = nearMisses[:NEAR_MISS_LIMIT]
+		}
+		testResult.NearMisses = nearMisses
+	} else {
+		testResult.NearMisses = nil
+	}
+}
+
+// The id of the transaction matched to the test result, if any
+func matchedTransactionId(testResult *TestResult) string {
+	if testResult.Transaction == nil {
+		return ""
+	}
+	return testResult.Transaction.Id.Hex()
+}
+
+// Combine newly found unmatched transactions with those already recorded, most recent first
+// within each URL and the most frequently hit URLs first
+func mergeUnmatchedTransactions(groups []*UnmatchedTransactionGroup, newGroups []*UnmatchedTransactionGroup) []*UnmatchedTransactionGroup {
+
+	groupsByUrl := make(map[string]*UnmatchedTransactionGroup)
+	for _, group := range groups {
+		groupsByUrl[group.Url] = group
+	}
+
+	for _, newGroup := range newGroups {
+		group, ok := groupsByUrl[newGroup.Url]
+		if !ok {
+			groupsByUrl[newGroup.Url] = newGroup
+			groups = append(groups, newGroup)
+			continue
+		}
+
+		group.Count += newGroup.Count
+		group.Transactions = append(newGroup.Transactions, group.Transactions...)
+		sort.SliceStable(group.Transactions, func(i, j int) bool {
+			return group.Transactions[i].TransactionId.Hex() > group.Transactions[j].TransactionId.Hex()
+		})
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Count > groups[j].Count
+	})
+
+	return groups
+}
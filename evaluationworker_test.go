@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// A transaction whose id was generated before that of one already evaluated, but which was only
+// stored afterwards, must still be taken into account by the next refresh
+func TestOutOfOrderTransactionAfterRefresh(t *testing.T) {
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("refresh", func(mt *mtest.T) {
+		txCollection = mt.Coll
+
+		now := time.Now()
+		testCase := &TestCase{Id: primitive.NewObjectID(), Name: "Create a payment", Url: "/payments", Methods: []string{"POST"}, ExpectedStatus: "201"}
+		testRun := TestRun{
+			Id:              primitive.NewObjectID(),
+			TestRunHeaderId: "run-1",
+			TestSuite:       &TestSuite{TestCases: []*TestCase{testCase}},
+			Status:          Created,
+			Timestamp:       now.Add(-time.Hour),
+		}
+
+		later := Transaction{Id: primitive.NewObjectIDFromTimestamp(now), TestRunId: "run-1", Method: "GET", Url: "/payments/1", Status: 200}
+		if err := matchTransactionsToTestRun(&testRun, []Transaction{later}); err != nil {
+			mt.Fatal(err)
+		}
+
+		// Stored after the refresh above with an id from a second earlier
+		earlier := Transaction{Id: primitive.NewObjectIDFromTimestamp(now.Add(-time.Second)), TestRunId: "run-1", Method: "POST", Url: "/payments", Status: 201}
+
+		addDocumentsResponse(mt, later, earlier)
+		changed, err := applyNewTransactions(&testRun)
+		if err != nil {
+			mt.Fatal(err)
+		}
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		since := filter.Lookup("_id", "$gt").ObjectID()
+		if since != transactionWindowStart(later.Id) {
+			mt.Fatalf("queried transactions after %s, want the start of the grace period %s", since.Hex(), transactionWindowStart(later.Id).Hex())
+		}
+
+		testResult := testRun.TestResults[0]
+		if !changed || testResult.Status != Success || testResult.Transaction.Id != earlier.Id {
+			mt.Fatalf("out of order transaction was not matched: changed %v, status %s", changed, testResult.Status)
+		}
+		if testRun.LastTransactionId != later.Id {
+			mt.Fatalf("last transaction is %s, want %s", testRun.LastTransactionId.Hex(), later.Id.Hex())
+		}
+
+		// Both are still within the grace period, but neither is taken into account twice
+		addDocumentsResponse(mt, later, earlier)
+		changed, err = applyNewTransactions(&testRun)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if changed || testResult.NumAttempts != 1 {
+			mt.Fatalf("transactions were merged again: changed %v, %d attempts", changed, testResult.NumAttempts)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Walk a transaction through every matching step for the test case, recording what was
+// found at each step. Unlike matchTransactionToTestCase, evaluation carries on past the
+// first failing step so that everything wrong with the transaction is reported.
+func explainTransaction(testCase TestCase, transaction Transaction) TransactionExplanation {
+
+	explanation := TransactionExplanation{
+		TransactionId:  transaction.Id,
+		Method:         transaction.Method,
+		Url:            transaction.Url,
+		Status:         transaction.Status,
+		Timestamp:      transactionTime(transaction),
+		ExpectedStatus: testCase.ExpectedStatus,
+	}
+
+	explanation.UrlMatched = urlMatches(transaction.Url, testCase.Url)
+	explanation.MethodMatched = methodMatches(transaction.Method, testCase.Methods)
+
+	for _, predicate := range testCase.Predicates {
+		explanation.Predicates = append(explanation.Predicates, explainPredicate(transaction, predicate, ""))
+	}
+	if testCase.PredicateGroup != nil {
+		explanation.Predicates = append(explanation.Predicates,
+			explainPredicateGroup(transaction, testCase.PredicateGroup, "predicate_group", "")...)
+	}
+
+	// The predicates match when every top level criterion, predicate or group, passes
+	explanation.PredicatesMatched = true
+	for _, predicate := range explanation.Predicates {
+		if predicate.Group == "" && !predicate.Passed {
+			explanation.PredicatesMatched = false
+		}
+	}
+
+	explanation.StatusMatched = testCase.ExpectedStatus.Matches(transaction.Status)
+
+	// Report the first step that stopped this transaction matching the test case
+	switch {
+	case !explanation.UrlMatched:
+		explanation.FailedStep = StepUrl
+	case !explanation.MethodMatched:
+		explanation.FailedStep = StepMethod
+	case !explanation.PredicatesMatched:
+		explanation.FailedStep = StepPredicates
+	case !explanation.StatusMatched:
+		explanation.FailedStep = StepStatus
+	}
+
+	return explanation
+}
+
+// Evaluate a single predicate, recording the value gjson found for it
+func explainPredicate(transaction Transaction, predicate *TestCasePredicate, group string) PredicateExplanation {
+
+	value := predicateValue(transaction, predicate)
+
+	return PredicateExplanation{
+		Predicate: prettyFormatPredicate(predicate),
+		Group:     group,
+		Source:    predicateSource(predicate),
+		Attribute: predicate.Attribute,
+		Operator:  predicateOperator(predicate),
+		Expected:  predicate.ExpectedValue,
+		Actual:    value.String(),
+		Found:     value.Exists(),
+		Passed:    compareValue(value, predicate),
+	}
+}
+
+// Explain the group as a whole, followed by every predicate in it and its nested groups.
+// Members are labelled with the path to their group, e.g. predicate_group.groups[1] (OR),
+// and the group itself with the label of the group containing it, if any.
+func explainPredicateGroup(transaction Transaction, group *PredicateGroup, path string, parent string) []PredicateExplanation {
+
+	label := fmt.Sprintf("%s (%s)", path, group.Operator)
+
+	explanations := []PredicateExplanation{{
+		Predicate: prettyFormatPredicateGroup(group),
+		Group:     parent,
+		IsGroup:   true,
+		Path:      label,
+		Operator:  group.Operator,
+		Found:     true,
+		Passed:    matchPredicateGroup(transaction, group),
+	}}
+
+	for _, predicate := range group.Predicates {
+		explanations = append(explanations, explainPredicate(transaction, predicate, label))
+	}
+
+	for i, nestedGroup := range group.Groups {
+		nestedPath := fmt.Sprintf("%s.groups[%d]", path, i)
+		explanations = append(explanations, explainPredicateGroup(transaction, nestedGroup, nestedPath, label)...)
+	}
+
+	return explanations
+}
+
+// How deeply each explanation is nested in predicate groups: 0 for top level criteria,
+// including the predicate group itself, 1 for members of that group and so on
+func explanationDepths(explanations []PredicateExplanation) []int {
+
+	depths := make([]int, len(explanations))
+	groupDepths := make(map[string]int)
+
+	for i, explanation := range explanations {
+		if explanation.Group != "" {
+			depths[i] = groupDepths[explanation.Group] + 1
+		}
+		if explanation.IsGroup {
+			groupDepths[explanation.Path] = depths[i]
+		}
+	}
+
+	return depths
+}
+
+// Explain how each of the run's transactions fares against the test case
+func explainTestCase(testRun TestRun, testCase TestCase, transactions []Transaction) TestCaseExplanation {
+
+	explanation := TestCaseExplanation{TestRunId: testRun.Id, TestCase: &testCase}
+
+	_, explanation.Status, _, _ = matchTransactionToTestCase(testCase, transactions)
+
+	explanation.Transactions = make([]TransactionExplanation, 0, len(transactions))
+	for _, transaction := range transactions {
+		explanation.Transactions = append(explanation.Transactions, explainTransaction(testCase, transaction))
+	}
+
+	return explanation
+}
+
+// The number of near misses suggested for each NotAttempted test case
+const NEAR_MISS_LIMIT = 3
+
+// Rank the transactions that hit the test case's URL pattern by how close they came to
+// matching it. A transaction scores a point for each top level criterion it satisfies and one
+// for using an accepted method, out of one more than the number of criteria. The predicate
+// group counts as a single criterion, and is reported as a whole when it fails.
+func findNearMisses(testCase TestCase, transactions []Transaction) []NearMiss {
+
+	var nearMisses []NearMiss
+
+	for _, transaction := range transactions {
+
+		explanation := explainTransaction(testCase, transaction)
+		if !explanation.UrlMatched {
+			continue
+		}
+
+		nearMiss := NearMiss{
+			TransactionId: transaction.Id,
+			Method:        transaction.Method,
+			Url:           transaction.Url,
+			Status:        transaction.Status,
+			Timestamp:     transactionTime(transaction),
+			MethodMatched: explanation.MethodMatched,
+		}
+
+		points := 0
+		if explanation.MethodMatched {
+			points++
+		}
+		for _, predicate := range explanation.Predicates {
+			if predicate.Group != "" {
+				continue // a member of the predicate group, which is scored as a whole
+			}
+
+			nearMiss.NumPredicates++
+			if predicate.Passed {
+				nearMiss.NumPredicatesPassed++
+				points++
+			} else {
+				nearMiss.FailedPredicates = append(nearMiss.FailedPredicates, predicate)
+			}
+		}
+		nearMiss.Score = float64(points) / float64(nearMiss.NumPredicates+1)
+
+		nearMisses = append(nearMisses, nearMiss)
+	}
+
+	// Transactions are most recent first, so equal scores keep the most recent first
+	sort.SliceStable(nearMisses, func(i, j int) bool {
+		return nearMisses[i].Score > nearMisses[j].Score
+	})
+
+	if len(nearMisses) > NEAR_MISS_LIMIT {
+		nearMisses = nearMisses[:NEAR_MISS_LIMIT]
+	}
+
+	return nearMisses
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// A test run report laid out for the HTML template
+type htmlReport struct {
+	Title           string
+	SuiteName       string
+	RunName         string
+	RunId           string
+	ApiKey          string
+	Status          string
+	Generated       string
+	NumTestCases    int
+	NumPassed       int
+	NumFailed       int
+	NumNotAttempted int
+	TestCases       []htmlTestCase
+}
+
+type htmlTestCase struct {
+	Name           string
+	Url            string
+	Methods        string
+	ExpectedStatus StatusSpec
+	Status         string
+	Optional       bool
+	Checks         []htmlCheck
+	Evidence       *htmlEvidence
+}
+
+// A single line of a test case's checklist. Members of a predicate group are nested beneath it
+// and show their value, "true" or "false", rather than passing or failing themselves.
+type htmlCheck struct {
+	Text   string
+	Actual string
+	State  string // "pass", "fail", "pending", "true" or "false"
+	Depth  int
+}
+
+// The transaction matched against a test case
+type htmlEvidence struct {
+	Id              string
+	Method          string
+	Url             string
+	Query           string
+	Status          int
+	Timestamp       string
+	Headers         string
+	Request         string
+	ResponseHeaders string
+	Response        string
+}
+
+// Render the report as a single HTML page with all of its styling inline, so it can be
+// opened from disk or attached to an email
+func writeHtmlReport(testRunReport TestRunReport, w io.Writer) error {
+
+	report := htmlReport{
+		NumTestCases: testRunReport.NumTestCases,
+		Status:       testRunReport.Status.String(),
+		Generated:    time.Now().UTC().Format(time.RFC1123),
+	}
+
+	if testRunReport.TestSuite != nil {
+		report.SuiteName = testRunReport.TestSuite.Name
+	}
+	if testRun := testRunReport.TestRun; testRun != nil {
+		report.RunName = testRun.Name
+		report.RunId = testRun.Id.Hex()
+		report.ApiKey = testRun.ApiKey
+	}
+	report.Title = strings.TrimSpace(report.SuiteName + " " + report.RunName)
+
+	for _, testCaseReport := range testRunReport.TestCaseReports {
+		switch testCaseReport.Status {
+		case Success:
+			report.NumPassed++
+		case Failure:
+			report.NumFailed++
+		default:
+			report.NumNotAttempted++
+		}
+		report.TestCases = append(report.TestCases, htmlTestCaseFor(testCaseReport))
+	}
+
+	return htmlReportTemplate.Execute(w, report)
+}
+
+func htmlTestCaseFor(testCaseReport TestCaseReport) htmlTestCase {
+
+	testCase := testCaseReport.TestCase
+
+	htmlCase := htmlTestCase{
+		Name:           testCase.Name,
+		Url:            testCase.Url,
+		Methods:        strings.Join(testCase.Methods, ", "),
+		ExpectedStatus: testCase.ExpectedStatus,
+		Status:         testCaseReport.Status.String(),
+		Optional:       testCase.Optional,
+	}
+
+	// Without a transaction there is nothing to check the criteria against
+	transaction := testCaseReport.Transaction
+	if transaction == nil {
+		for _, predicate := range testCase.Predicates {
+			htmlCase.Checks = append(htmlCase.Checks, htmlCheck{Text: prettyFormatPredicate(predicate), State: "pending"})
+		}
+		if testCase.PredicateGroup != nil {
+			htmlCase.Checks = append(htmlCase.Checks, htmlCheck{Text: prettyFormatPredicateGroup(testCase.PredicateGroup), State: "pending"})
+		}
+		return htmlCase
+	}
+
+	explanation := explainTransaction(*testCase, *transaction)
+
+	depths := explanationDepths(explanation.Predicates)
+	for i, predicate := range explanation.Predicates {
+		check := htmlCheck{Text: predicate.Predicate, Actual: predicate.Actual, Depth: depths[i]}
+		switch {
+		case depths[i] > 0:
+			check.State = fmt.Sprint(predicate.Passed)
+		case predicate.Passed:
+			check.State = "pass"
+		default:
+			check.State = "fail"
+		}
+		htmlCase.Checks = append(htmlCase.Checks, check)
+	}
+
+	statusCheck := htmlCheck{Text: "Status code is " + string(testCase.ExpectedStatus), State: "fail"}
+	if explanation.StatusMatched {
+		statusCheck.State = "pass"
+	}
+	htmlCase.Checks = append(htmlCase.Checks, statusCheck)
+
+	htmlCase.Evidence = &htmlEvidence{
+		Id:              transaction.Id.Hex(),
+		Method:          transaction.Method,
+		Url:             transaction.Url,
+		Query:           transaction.Query,
+		Status:          transaction.Status,
+		Timestamp:       transactionTime(*transaction).UTC().Format(time.RFC3339),
+		Headers:         indentJson(transaction.Headers),
+		Request:         indentJson(transaction.Request),
+		ResponseHeaders: indentJson(transaction.ResponseHeaders),
+		Response:        indentJson(transaction.Response),
+	}
+
+	return htmlCase
+}
+
+// Pretty print a JSON body for display, leaving anything that isn't JSON as it is
+func indentJson(body string) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(body), "", "  "); err != nil {
+		return body
+	}
+	return out.String()
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Test Run Report{{if .Title}} - {{.Title}}{{end}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 960px; color: #222; padding: 0 1em; }
+h1 { font-size: 1.6em; margin-bottom: 0.2em; }
+.meta { color: #666; font-size: 0.9em; }
+.meta span { margin-right: 1.5em; }
+.summary { display: flex; gap: 1em; margin: 1.5em 0; }
+.tile { flex: 1; border-radius: 6px; padding: 0.8em 1em; background: #f4f4f4; }
+.tile .count { font-size: 1.8em; font-weight: bold; }
+.tile.Success { background: #e6f4ea; color: #1e6b34; }
+.tile.Failure { background: #fce8e6; color: #a50e0e; }
+.tile.NotAttempted { background: #f1f3f4; color: #5f6368; }
+.case { border: 1px solid #ddd; border-left-width: 6px; border-radius: 4px; margin: 1em 0; padding: 0.8em 1em; }
+.case.Success { border-left-color: #34a853; }
+.case.Failure { border-left-color: #ea4335; }
+.case.NotAttempted { border-left-color: #9aa0a6; }
+.case h2 { font-size: 1.1em; margin: 0 0 0.4em 0; }
+.badge { font-size: 0.75em; border-radius: 3px; padding: 0.1em 0.5em; margin-left: 0.5em; vertical-align: middle; background: #eee; }
+.badge.Success { background: #34a853; color: #fff; }
+.badge.Failure { background: #ea4335; color: #fff; }
+.badge.NotAttempted { background: #9aa0a6; color: #fff; }
+.details { font-size: 0.9em; color: #444; }
+.details code { background: #f4f4f4; padding: 0 0.3em; }
+ul.checks { list-style: none; padding-left: 0; }
+ul.checks li { font-family: Menlo, Consolas, monospace; font-size: 0.85em; padding: 0.15em 0; }
+ul.checks li::before { display: inline-block; width: 1.5em; }
+ul.checks li.pass::before { content: "\2714"; color: #34a853; }
+ul.checks li.fail::before { content: "\2718"; color: #ea4335; }
+ul.checks li.pending::before { content: "\25CB"; color: #9aa0a6; }
+ul.checks li.true::before, ul.checks li.false::before { content: "\2022"; color: #9aa0a6; }
+.actual, .value { color: #777; }
+details { margin-top: 0.5em; }
+summary { cursor: pointer; font-size: 0.9em; color: #1a73e8; }
+pre { background: #f8f9fa; border: 1px solid #eee; padding: 0.6em; overflow-x: auto; font-size: 0.8em; }
+h3 { font-size: 0.9em; margin: 0.8em 0 0.2em 0; }
+</style>
+</head>
+<body>
+<h1>Test Run Report</h1>
+<div class="meta">
+{{if .SuiteName}}<span>Suite: <strong>{{.SuiteName}}</strong></span>{{end}}
+{{if .RunName}}<span>Run: <strong>{{.RunName}}</strong></span>{{end}}
+{{if .RunId}}<span>Id: {{.RunId}}</span>{{end}}
+{{if .ApiKey}}<span>API key: {{.ApiKey}}</span>{{end}}
+<span>Status: <strong>{{.Status}}</strong></span>
+<span>Generated: {{.Generated}}</span>
+</div>
+<div class="summary">
+<div class="tile"><div class="count">{{.NumTestCases}}</div>Test cases</div>
+<div class="tile Success"><div class="count">{{.NumPassed}}</div>Passed</div>
+<div class="tile Failure"><div class="count">{{.NumFailed}}</div>Failed</div>
+<div class="tile NotAttempted"><div class="count">{{.NumNotAttempted}}</div>Not attempted</div>
+</div>
+{{range .TestCases}}
+<div class="case {{.Status}}">
+<h2>{{.Name}}<span class="badge {{.Status}}">{{.Status}}</span>{{if .Optional}}<span class="badge">Optional</span>{{end}}</h2>
+<div class="details">URL: <code>{{.Url}}</code>{{if .Methods}} &middot; Method: <code>{{.Methods}}</code>{{end}} &middot; Expected Status Code: <code>{{.ExpectedStatus}}</code></div>
+{{if .Checks}}<ul class="checks">
+{{range .Checks}}<li class="{{.State}}" style="margin-left: {{.Depth}}em">{{.Text}}{{if or (eq .State "true") (eq .State "false")}} <span class="value">is {{.State}}</span>{{end}}{{if or (eq .State "fail") (eq .State "false")}}{{if .Actual}} <span class="actual">(actual: {{.Actual}})</span>{{end}}{{end}}</li>
+{{end}}</ul>{{end}}
+{{with .Evidence}}<details>
+<summary>Evidence: {{.Method}} {{.Url}} &rarr; {{.Status}}</summary>
+<div class="details">Transaction <code>{{.Id}}</code> at {{.Timestamp}}{{if .Query}} &middot; Query: <code>{{.Query}}</code>{{end}}</div>
+{{if .Headers}}<h3>Request headers</h3><pre>{{.Headers}}</pre>{{end}}
+{{if .Request}}<h3>Request body</h3><pre>{{.Request}}</pre>{{end}}
+{{if .ResponseHeaders}}<h3>Response headers</h3><pre>{{.ResponseHeaders}}</pre>{{end}}
+{{if .Response}}<h3>Response body</h3><pre>{{.Response}}</pre>{{end}}
+</details>{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
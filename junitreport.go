@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Id         string          `xml:"id,attr,omitempty"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Details string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// Render the report as JUnit XML: the test suite is the JUnit testsuite, each test case report
+// a testcase, failures carry the mismatching status and predicates, and cases that were never
+// attempted are skipped
+func writeJunitReport(testRunReport TestRunReport, w io.Writer) error {
+
+	suite := junitTestSuite{Tests: testRunReport.NumTestCases}
+
+	if testRunReport.TestSuite != nil {
+		suite.Name = testRunReport.TestSuite.Name
+		suite.Id = testRunReport.TestSuite.Id.Hex()
+	}
+
+	if testRun := testRunReport.TestRun; testRun != nil {
+		suite.Timestamp = testRun.Timestamp.UTC().Format("2006-01-02T15:04:05")
+		suite.Properties = []junitProperty{
+			{Name: "testrun.id", Value: testRun.Id.Hex()},
+			{Name: "testrun.name", Value: testRun.Name},
+			{Name: "testrun.apikey", Value: testRun.ApiKey},
+			{Name: "testrun.status", Value: testRunReport.Status.String()},
+		}
+	}
+
+	for _, testCaseReport := range testRunReport.TestCaseReports {
+
+		testCase := junitTestCase{Name: testCaseReport.TestCase.Name, ClassName: suite.Name}
+
+		switch testCaseReport.Status {
+		case Failure:
+			suite.Failures++
+			testCase.Failure = junitFailureFor(testCaseReport)
+		case Success:
+			if testCaseReport.Transaction != nil {
+				testCase.SystemOut = fmt.Sprintf("Matched transaction %s with status %d",
+					testCaseReport.Transaction.Id.Hex(), testCaseReport.Transaction.Status)
+			}
+		default:
+			suite.Skipped++
+			testCase.Skipped = &junitSkipped{Message: "not attempted"}
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	suites := junitTestSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	io.WriteString(w, xml.Header)
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(suites)
+}
+
+// Describe why a failed test case failed, using the transaction that was matched against it
+func junitFailureFor(testCaseReport TestCaseReport) *junitFailure {
+
+	failure := &junitFailure{Type: "failure", Message: "test case failed"}
+
+	if testCaseReport.Transaction == nil {
+		return failure
+	}
+
+	explanation := explainTransaction(*testCaseReport.TestCase, *testCaseReport.Transaction)
+
+	var details strings.Builder
+	fmt.Fprintf(&details, "Transaction: %s %s %s\n", explanation.TransactionId.Hex(), explanation.Method, explanation.Url)
+	fmt.Fprintf(&details, "Status: expected %s, got %d\n", explanation.ExpectedStatus, explanation.Status)
+	fmt.Fprintf(&details, "Criteria:\n")
+
+	// Top level criteria pass or fail; members of a group are shown beneath it with their value
+	depths := explanationDepths(explanation.Predicates)
+	for i, predicate := range explanation.Predicates {
+		indent := strings.Repeat("\t", depths[i]+1)
+		if depths[i] == 0 {
+			outcome := "PASS"
+			if !predicate.Passed {
+				outcome = "FAIL"
+			}
+			fmt.Fprintf(&details, "%s[%s] %s", indent, outcome, predicate.Predicate)
+		} else {
+			fmt.Fprintf(&details, "%s%s: %t", indent, predicate.Predicate, predicate.Passed)
+		}
+		if !predicate.IsGroup {
+			fmt.Fprintf(&details, " (actual: %s)", predicate.Actual)
+		}
+		fmt.Fprintf(&details, "\n")
+	}
+	failure.Details = details.String()
+
+	switch explanation.FailedStep {
+	case StepStatus:
+		failure.Type = StepStatus
+		failure.Message = fmt.Sprintf("expected status %s, got %d", explanation.ExpectedStatus, explanation.Status)
+	case StepPredicates:
+		failure.Type = StepPredicates
+		failure.Message = "transaction did not satisfy the test case criteria"
+	}
+
+	return failure
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// How each operator is written when a predicate is pretty formatted
+var operatorSymbols = map[string]string{
+	OpEquals:             "==",
+	OpNotEquals:          "!=",
+	OpGreaterThan:        ">",
+	OpGreaterThanOrEqual: ">=",
+	OpLessThan:           "<",
+	OpLessThanOrEqual:    "<=",
+	OpRegex:              "=~",
+	OpContains:           "contains",
+	OpStartsWith:         "startsWith",
+	OpIn:                 "in",
+	OpExists:             "exists",
+	OpNotExists:          "notExists",
+}
+
+// The operator to apply for this predicate, defaulting to case-insensitive equality
+func predicateOperator(predicate *TestCasePredicate) string {
+	if predicate.Operator == "" {
+		return OpEquals
+	}
+	return predicate.Operator
+}
+
+// The part of the transaction this predicate is evaluated against, defaulting to the request body
+func predicateSource(predicate *TestCasePredicate) string {
+	if predicate.Source == "" {
+		return SourceRequest
+	}
+	return predicate.Source
+}
+
+// Check that the predicate is well formed before it is stored
+func validatePredicate(predicate TestCasePredicate) error {
+
+	operator := predicateOperator(&predicate)
+
+	if _, ok := operatorSymbols[operator]; !ok {
+		return NewErrorResponse(http.StatusBadRequest, "unknown predicate operator "+operator)
+	}
+
+	if predicate.Attribute == "" {
+		return NewErrorResponse(http.StatusBadRequest, "predicate attribute is required")
+	}
+
+	switch predicateSource(&predicate) {
+	case SourceRequest, SourceResponse, SourceRequestHeader, SourceResponseHeader, SourceQuery:
+	default:
+		return NewErrorResponse(http.StatusBadRequest, "unknown predicate source "+predicate.Source)
+	}
+
+	switch predicate.ExpectedType {
+	case "", TypeString, TypeNumber, TypeBool, TypeNull, TypeObject, TypeArray:
+	default:
+		return NewErrorResponse(http.StatusBadRequest, "unknown expected type "+predicate.ExpectedType)
+	}
+
+	switch operator {
+	case OpGreaterThan, OpGreaterThanOrEqual, OpLessThan, OpLessThanOrEqual:
+		if predicate.ExpectedType != "" && predicate.ExpectedType != TypeNumber {
+			return NewErrorResponse(http.StatusBadRequest, operator+" can only be used with numbers")
+		}
+		if _, err := strconv.ParseFloat(predicate.ExpectedValue, 64); err != nil {
+			return NewErrorResponse(http.StatusBadRequest, "expected value for "+operator+" must be a number")
+		}
+	case OpRegex:
+		if _, err := regexp.Compile(predicate.ExpectedValue); err != nil {
+			return NewErrorResponse(http.StatusBadRequest, "invalid regex: "+err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Split the expected value of an `in` predicate into its comma separated members
+func expectedValueList(expectedValue string) []string {
+
+	var values []string
+	for _, value := range strings.Split(expectedValue, ",") {
+		values = append(values, strings.TrimSpace(value))
+	}
+
+	return values
+}
+
+// Find the value the predicate's attribute refers to in the relevant part of the transaction
+func predicateValue(transaction Transaction, predicate *TestCasePredicate) gjson.Result {
+
+	switch predicateSource(predicate) {
+	case SourceRequest:
+		return gjson.Get(transaction.Request, predicate.Attribute)
+	case SourceResponse:
+		return gjson.Get(transaction.Response, predicate.Attribute)
+	case SourceRequestHeader:
+		return headerValue(transaction.Headers, predicate.Attribute)
+	case SourceResponseHeader:
+		return headerValue(transaction.ResponseHeaders, predicate.Attribute)
+	case SourceQuery:
+		return queryValue(transaction, predicate.Attribute)
+	}
+
+	return gjson.Result{}
+}
+
+// Look up a header in a JSON object of headers. Header names are case-insensitive, and
+// multi-valued headers (as recorded from an http.Header) yield their first value.
+func headerValue(headers string, name string) gjson.Result {
+
+	var value gjson.Result
+
+	gjson.Parse(headers).ForEach(func(key, headerValue gjson.Result) bool {
+		if !strings.EqualFold(key.String(), name) {
+			return true // keep looking
+		}
+
+		if headerValue.IsArray() {
+			value = headerValue.Get("0")
+		} else {
+			value = headerValue
+		}
+		return false
+	})
+
+	return value
+}
+
+// Look up a query parameter from the transaction's query string, or failing that its URL
+func queryValue(transaction Transaction, name string) gjson.Result {
+
+	rawQuery := transaction.Query
+	if rawQuery == "" {
+		if i := strings.Index(transaction.Url, "?"); i >= 0 {
+			rawQuery = transaction.Url[i+1:]
+		}
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return gjson.Result{}
+	}
+
+	values, ok := query[name]
+	if !ok || len(values) == 0 {
+		return gjson.Result{}
+	}
+
+	// Query parameters are always strings
+	quoted, _ := json.Marshal(values[0])
+	return gjson.ParseBytes(quoted)
+}
+
+// Apply the predicate's operator to the value found in the transaction
+func compareValue(value gjson.Result, predicate *TestCasePredicate) bool {
+
+	operator := predicateOperator(predicate)
+
+	// Existence checks are the only operators that apply to missing values
+	switch operator {
+	case OpExists:
+		return value.Exists()
+	case OpNotExists:
+		return !value.Exists()
+	}
+
+	if !value.Exists() {
+		return false
+	}
+
+	if predicate.ExpectedType != "" {
+		return compareTypedValue(value, predicate.ExpectedType, operator, predicate.ExpectedValue)
+	}
+
+	actual := strings.ToLower(cleanse(value.Raw))
+	expected := strings.ToLower(predicate.ExpectedValue)
+
+	switch operator {
+	case OpEquals:
+		return actual == expected
+	case OpNotEquals:
+		return actual != expected
+	case OpGreaterThan, OpGreaterThanOrEqual, OpLessThan, OpLessThanOrEqual:
+		return compareNumbers(actual, expected, operator)
+	case OpRegex:
+		matched, err := regexp.MatchString(predicate.ExpectedValue, cleanse(value.Raw))
+		return err == nil && matched
+	case OpContains:
+		return strings.Contains(actual, expected)
+	case OpStartsWith:
+		return strings.HasPrefix(actual, expected)
+	case OpIn:
+		for _, member := range expectedValueList(expected) {
+			if actual == member {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Unknown operator
+	return false
+}
+
+// Check whether the gjson result is of the declared JSON type
+func valueHasType(value gjson.Result, expectedType string) bool {
+
+	switch expectedType {
+	case TypeString:
+		return value.Type == gjson.String
+	case TypeNumber:
+		return value.Type == gjson.Number
+	case TypeBool:
+		return value.Type == gjson.True || value.Type == gjson.False
+	case TypeNull:
+		return value.Type == gjson.Null
+	case TypeObject:
+		return value.IsObject()
+	case TypeArray:
+		return value.IsArray()
+	}
+
+	return false
+}
+
+// Strict comparison for predicates that declare an expected type: the value must be of that
+// type, strings compare case-sensitively and numbers compare numerically (300 == 300.00)
+func compareTypedValue(value gjson.Result, expectedType string, operator string, expectedValue string) bool {
+
+	if !valueHasType(value, expectedType) {
+		return false
+	}
+
+	// Existence is all that can be said about a null
+	if expectedType == TypeNull {
+		return true
+	}
+
+	// Every member of an `in` list is compared in the same way as a single expected value
+	if operator == OpIn {
+		for _, member := range expectedValueList(expectedValue) {
+			if compareTypedValue(value, expectedType, OpEquals, member) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var actual string
+	switch expectedType {
+	case TypeString:
+		actual = value.Str
+	case TypeNumber:
+		switch operator {
+		case OpEquals, OpNotEquals, OpGreaterThan, OpGreaterThanOrEqual, OpLessThan, OpLessThanOrEqual:
+			expectedNumber, err := strconv.ParseFloat(expectedValue, 64)
+			if err != nil {
+				return false
+			}
+			return compareFloats(value.Float(), expectedNumber, operator)
+		}
+		actual = value.Raw
+	case TypeBool:
+		expectedBool, err := strconv.ParseBool(expectedValue)
+		if err != nil {
+			return false
+		}
+		switch operator {
+		case OpEquals:
+			return value.Bool() == expectedBool
+		case OpNotEquals:
+			return value.Bool() != expectedBool
+		}
+		return false
+	case TypeObject, TypeArray:
+		// Structures are compared on their compacted JSON; with no expected value the type alone must match
+		if expectedValue == "" {
+			return operator == OpEquals
+		}
+		actual = value.Get("@ugly").Raw
+		expectedValue = gjson.Get(expectedValue, "@ugly").Raw
+	}
+
+	switch operator {
+	case OpEquals:
+		return actual == expectedValue
+	case OpNotEquals:
+		return actual != expectedValue
+	case OpRegex:
+		matched, err := regexp.MatchString(expectedValue, actual)
+		return err == nil && matched
+	case OpContains:
+		return strings.Contains(actual, expectedValue)
+	case OpStartsWith:
+		return strings.HasPrefix(actual, expectedValue)
+	}
+
+	return false
+}
+
+// Numeric comparison; values that are not numbers never match
+func compareNumbers(actual string, expected string, operator string) bool {
+
+	actualNumber, err := strconv.ParseFloat(actual, 64)
+	if err != nil {
+		return false
+	}
+
+	expectedNumber, err := strconv.ParseFloat(expected, 64)
+	if err != nil {
+		return false
+	}
+
+	return compareFloats(actualNumber, expectedNumber, operator)
+}
+
+func compareFloats(actual float64, expected float64, operator string) bool {
+
+	switch operator {
+	case OpEquals:
+		return actual == expected
+	case OpNotEquals:
+		return actual != expected
+	case OpGreaterThan:
+		return actual > expected
+	case OpGreaterThanOrEqual:
+		return actual >= expected
+	case OpLessThan:
+		return actual < expected
+	case OpLessThanOrEqual:
+		return actual <= expected
+	}
+
+	return false
+}
+
+/*
+amount.total == 300
+amount.total == 300 (number)
+response:status == AUTHORIZED
+card.brand in (VISA, MASTERCARD)
+source.cvv notExists
+*/
+func prettyFormatPredicate(predicate *TestCasePredicate) string {
+
+	operator := predicateOperator(predicate)
+
+	// Predicates on anything other than the request body are prefixed with their source
+	attribute := predicate.Attribute
+	if predicateSource(predicate) != SourceRequest {
+		attribute = predicate.Source + ":" + attribute
+	}
+
+	var formatted string
+	switch operator {
+	case OpExists, OpNotExists:
+		formatted = fmt.Sprintf("%s %s", attribute, operatorSymbols[operator])
+	case OpIn:
+		formatted = fmt.Sprintf("%s in (%s)", attribute, strings.Join(expectedValueList(predicate.ExpectedValue), ", "))
+	default:
+		expectedValue := predicate.ExpectedValue
+		if predicate.ExpectedType == TypeNull && expectedValue == "" {
+			expectedValue = "null"
+		}
+		formatted = fmt.Sprintf("%s %s %s", attribute, operatorSymbols[operator], expectedValue)
+	}
+
+	if predicate.ExpectedType != "" {
+		formatted += fmt.Sprintf(" (%s)", predicate.ExpectedType)
+	}
+
+	return formatted
+}
+
+// Evaluate a predicate group against the transaction
+func matchPredicateGroup(transaction Transaction, group *PredicateGroup) bool {
+
+	// Collect the result of every member of the group, predicates first
+	var results []bool
+	for _, predicate := range group.Predicates {
+		results = append(results, matchPredicate(transaction, predicate))
+	}
+	for _, nestedGroup := range group.Groups {
+		results = append(results, matchPredicateGroup(transaction, nestedGroup))
+	}
+
+	switch group.Operator {
+	case GroupOr:
+		for _, result := range results {
+			if result {
+				return true
+			}
+		}
+		return false
+	case GroupNot:
+		return !allTrue(results)
+	}
+
+	return allTrue(results)
+}
+
+func allTrue(results []bool) bool {
+	for _, result := range results {
+		if !result {
+			return false
+		}
+	}
+	return true
+}
+
+// Check that the predicate group and its nested groups are well formed
+func validatePredicateGroup(group *PredicateGroup) error {
+
+	switch group.Operator {
+	case GroupAnd, GroupOr, GroupNot:
+	default:
+		return NewErrorResponse(http.StatusBadRequest, "predicate group operator must be AND, OR or NOT")
+	}
+
+	if len(group.Predicates) == 0 && len(group.Groups) == 0 {
+		return NewErrorResponse(http.StatusBadRequest, "predicate group must contain predicates or groups")
+	}
+
+	for _, nestedGroup := range group.Groups {
+		if err := validatePredicateGroup(nestedGroup); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+	(card.brand == VISA OR card.brand == MASTERCARD)
+	NOT (source.cvv exists AND source.sourceType != PaymentCard)
+*/
+func prettyFormatPredicateGroup(group *PredicateGroup) string {
+
+	var members []string
+	for _, predicate := range group.Predicates {
+		members = append(members, prettyFormatPredicate(predicate))
+	}
+	for _, nestedGroup := range group.Groups {
+		members = append(members, prettyFormatPredicateGroup(nestedGroup))
+	}
+
+	if group.Operator == GroupNot {
+		return "NOT (" + strings.Join(members, " AND ") + ")"
+	}
+
+	return "(" + strings.Join(members, " "+group.Operator+" ") + ")"
+}
@@ -20,6 +20,11 @@ func createPredicate(w http.ResponseWriter, r *http.Request) {
 	// we decode our body request params
 	_ = json.NewDecoder(r.Body).Decode(&predicate)
 
+	if err := validatePredicate(predicate); err != nil {
+		SendError(err, w)
+		return
+	}
+
 	// insert our predicate
 	result, err := predicateCollection.InsertOne(context.TODO(), predicate)
 
@@ -141,11 +146,19 @@ func updatePredicate(w http.ResponseWriter, r *http.Request) {
 	// Read update model from body request
 	_ = json.NewDecoder(r.Body).Decode(&predicate)
 
+	if err := validatePredicate(predicate); err != nil {
+		SendError(err, w)
+		return
+	}
+
 	// prepare update model.
 	update := bson.D{
 		{"$set", bson.D{
 			{"attribute", predicate.Attribute},
 			{"expected_value", predicate.ExpectedValue},
+			{"operator", predicate.Operator},
+			{"expectedtype", predicate.ExpectedType},
+			{"source", predicate.Source},
 		}},
 	}
 
@@ -157,6 +170,12 @@ func updatePredicate(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 
+	// The suites using the predicate have changed, and certificates record which version passed
+	if err := refreshTestSuitesUsingPredicate(id, context.TODO()); err != nil {
+		SendError(err, w)
+		return
+	}
+
 	predicate.Id = id
 
 	json.NewEncoder(w).Encode(predicate)
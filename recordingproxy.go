@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Requests carrying this header are recorded as transactions against the identified test run
+const TESTRUN_HEADER = "X-Testrun-Id"
+
+// The api key of the partner making the request
+const APIKEY_HEADER = "Api-Key"
+
+// Context key under which the details of an inbound request to be recorded are stashed
+type recordedRequestKey struct{}
+
+// What we need to remember about an inbound request until its response comes back
+type recordedRequest struct {
+	TestRunId string
+	ApiKey    string
+	Method    string
+	Url       string
+	Query     string
+	Headers   string
+	Body      []byte
+}
+
+// Start a reverse proxy in front of the target API that records transactions for test runs.
+// Blocks for as long as the proxy is listening.
+func startRecordingProxy(target string, port string) {
+
+	targetUrl, err := url.Parse(target)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("Recording proxy forwarding to", target, "listening on port", port)
+
+	log.Fatal(http.ListenAndServe(":"+port, newRecordingProxy(targetUrl)))
+}
+
+// Build the recording reverse proxy handler for the target API
+func newRecordingProxy(target *url.URL) http.Handler {
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ModifyResponse = recordProxiedTransaction
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		testRunId := r.Header.Get(TESTRUN_HEADER)
+
+		// Requests that are not part of a test run are forwarded untouched
+		if testRunId != "" {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// Put the body back so it can still be forwarded upstream
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			headers, _ := json.Marshal(r.Header)
+
+			recorded := recordedRequest{
+				TestRunId: testRunId,
+				ApiKey:    r.Header.Get(APIKEY_HEADER),
+				Method:    r.Method,
+				Url:       r.URL.Path,
+				Query:     r.URL.RawQuery,
+				Headers:   string(headers),
+				Body:      decodedBody(body, r.Header.Get("Content-Encoding")),
+			}
+			r = r.WithContext(context.WithValue(r.Context(), recordedRequestKey{}, recorded))
+		}
+
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// Persist the request and upstream response as a Transaction for the test run.
+// Recording failures are logged but never affect the response returned to the caller.
+func recordProxiedTransaction(resp *http.Response) error {
+
+	recorded, ok := resp.Request.Context().Value(recordedRequestKey{}).(recordedRequest)
+	if !ok {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// Put the body back so it can still be returned to the caller
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	responseHeaders, _ := json.Marshal(resp.Header)
+
+	transaction := Transaction{
+		ApiKey:          recorded.ApiKey,
+		TestRunId:       recorded.TestRunId,
+		Status:          resp.StatusCode,
+		Method:          recorded.Method,
+		Url:             recorded.Url,
+		Query:           recorded.Query,
+		Headers:         recorded.Headers,
+		Request:         jsonBodyOrEmpty(recorded.Body),
+		ResponseHeaders: string(responseHeaders),
+		Response:        jsonBodyOrEmpty(decodedBody(body, resp.Header.Get("Content-Encoding"))),
+	}
+
+	err = validateTransaction(transaction)
+	if err == nil {
+		err = bindTransactionToTestRun(&transaction, make(map[string]TestRun), ctx)
+	}
+	if err == nil {
+		_, err = txCollection.InsertOne(ctx, transaction)
+	}
+
+	if err != nil {
+		log.Println("Could not record transaction for test run", recorded.TestRunId, ":", err.Error())
+	}
+
+	return nil
+}
+
+// The body as it was before any gzip content encoding, which the caller still receives as it is.
+// Other encodings are left alone, as are bodies that fail to decompress.
+func decodedBody(body []byte, contentEncoding string) []byte {
+
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return body
+		}
+		decoded, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return body
+		}
+		return decoded
+	}
+
+	return body
+}
+
+// Predicates can only be evaluated against JSON, so other bodies are not recorded
+func jsonBodyOrEmpty(body []byte) string {
+	if len(body) == 0 || !gjson.ValidBytes(body) {
+		return ""
+	}
+	return string(body)
+}
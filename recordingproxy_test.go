@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func TestDecodedBody(t *testing.T) {
+
+	body := []byte(`{"status":"AUTHORIZED"}`)
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(body)
+	writer.Flush()
+	writer.Close()
+
+	if decoded := decodedBody(compressed.Bytes(), "gzip"); !bytes.Equal(decoded, body) {
+		t.Fatalf("gzip body decoded as %q, want %q", decoded, body)
+	}
+	if decoded := decodedBody(body, ""); !bytes.Equal(decoded, body) {
+		t.Fatalf("unencoded body changed to %q", decoded)
+	}
+	if recorded := jsonBodyOrEmpty(decodedBody(compressed.Bytes(), "GZIP")); recorded != string(body) {
+		t.Fatalf("gzip response recorded as %q, want %q", recorded, body)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Formats reports and test suites can be rendered in
+const (
+	FormatJson     = "json"
+	FormatJunit    = "junit"
+	FormatHtml     = "html"
+	FormatCsv      = "csv"
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+)
+
+// Media types that select each format through the Accept header
+var formatMediaTypes = map[string]string{
+	"application/json": FormatJson,
+	"application/xml":  FormatJunit,
+	"text/xml":         FormatJunit,
+	"text/html":        FormatHtml,
+	"text/csv":         FormatCsv,
+	"text/markdown":    FormatMarkdown,
+	"text/plain":       FormatText,
+}
+
+// Work out which of the formats the resource can be rendered in the client asked for, from the
+// `format` query parameter or else the Accept header. The first format is the default, chosen
+// when there is no Accept header or it accepts anything. Fails with 400 for an unknown `format`
+// parameter and 406 when the client accepts none of the formats.
+func requestedFormat(r *http.Request, formats ...string) (string, error) {
+
+	if format := r.URL.Query().Get("format"); format != "" {
+		for _, known := range formatMediaTypes {
+			if strings.EqualFold(format, known) {
+				return known, checkFormatAvailable(known, formats)
+			}
+		}
+		return "", NewErrorResponse(http.StatusBadRequest, "unknown format "+format)
+	}
+
+	accept := strings.TrimSpace(r.Header.Get("Accept"))
+	if accept == "" {
+		return formats[0], nil
+	}
+
+	// Take the first media type the resource can be rendered as, ignoring any quality parameters
+	for _, mediaType := range strings.Split(accept, ",") {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(mediaType, ";")[0]))
+		if mediaType == "*/*" {
+			return formats[0], nil
+		}
+
+		for _, format := range formats {
+			if mediaTypeSelects(mediaType, format) {
+				return format, nil
+			}
+		}
+	}
+
+	return "", NewErrorResponse(http.StatusNotAcceptable, "none of the accepted media types is available for this resource")
+}
+
+// Whether an Accept media type, which may be a wildcard such as `text/*`, selects the format
+func mediaTypeSelects(mediaType string, format string) bool {
+
+	for candidate, candidateFormat := range formatMediaTypes {
+		if candidateFormat != format {
+			continue
+		}
+		if candidate == mediaType || (strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(candidate, strings.TrimSuffix(mediaType, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reject a format the resource cannot be rendered in
+func checkFormatAvailable(format string, formats []string) error {
+
+	for _, available := range formats {
+		if format == available {
+			return nil
+		}
+	}
+
+	return NewErrorResponse(http.StatusNotAcceptable, "format "+format+" is not available for this resource")
+}
+
+// Write the test run report in the format the client asked for
+func writeTestRunReport(testRunReport TestRunReport, w http.ResponseWriter, r *http.Request) {
+
+	format, err := requestedFormat(r, FormatJson, FormatHtml, FormatJunit, FormatCsv, FormatMarkdown)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		SendError(err, w)
+		return
+	}
+
+	switch format {
+	case FormatJson:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(testRunReport)
+	case FormatJunit:
+		w.Header().Set("Content-Type", "application/xml")
+		writeJunitReport(testRunReport, w)
+	case FormatHtml:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		writeHtmlReport(testRunReport, w)
+	case FormatCsv:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writeCsv(w, testRunReportColumns, testRunReportRows(testRunReport))
+	case FormatMarkdown:
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		writeMarkdownReport(testRunReport, w)
+	}
+}
+
+// The formats a test suite can be written in
+var testSuiteFormats = []string{FormatJson, FormatText, FormatCsv, FormatMarkdown}
+
+// Write the test suite in one of testSuiteFormats. JSON is the suite itself and text is its summary.
+func writeTestSuite(testSuite TestSuite, format string, w http.ResponseWriter) {
+
+	switch format {
+	case FormatJson:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(testSuite)
+	case FormatText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(prettyFormatTestSuite(testSuite)))
+	case FormatCsv:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writeCsv(w, testSuiteColumns, testSuiteRows(testSuite))
+	case FormatMarkdown:
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		writeMarkdownSuite(testSuite, w)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"
+
+func TestRequestedFormat(t *testing.T) {
+
+	reportFormats := []string{FormatJson, FormatHtml, FormatJunit, FormatCsv, FormatMarkdown}
+	summaryFormats := []string{FormatText, FormatJson, FormatCsv, FormatMarkdown}
+
+	tests := []struct {
+		name    string
+		url     string
+		accept  string
+		formats []string
+		format  string
+		status  int
+	}{
+		{"no accept header", "/", "", testSuiteFormats, FormatJson, 0},
+		{"browser asking for a test suite", "/", browserAccept, testSuiteFormats, FormatJson, 0},
+		{"browser asking for a summary", "/", browserAccept, summaryFormats, FormatText, 0},
+		{"browser asking for a report", "/", browserAccept, reportFormats, FormatHtml, 0},
+		{"first available type", "/", "application/xml, text/markdown, text/csv", testSuiteFormats, FormatMarkdown, 0},
+		{"wildcard subtype", "/", "text/*", testSuiteFormats, FormatText, 0},
+		{"nothing available", "/", "application/xml, image/png", testSuiteFormats, "", http.StatusNotAcceptable},
+		{"format parameter", "/?format=CSV", browserAccept, testSuiteFormats, FormatCsv, 0},
+		{"unavailable format parameter", "/?format=junit", "", testSuiteFormats, "", http.StatusNotAcceptable},
+		{"unknown format parameter", "/?format=pdf", "", testSuiteFormats, "", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			r := httptest.NewRequest("GET", test.url, nil)
+			if test.accept != "" {
+				r.Header.Set("Accept", test.accept)
+			}
+
+			format, err := requestedFormat(r, test.formats...)
+
+			if test.status != 0 {
+				response, ok := err.(ErrorResponse)
+				if !ok || response.StatusCode != test.status {
+					t.Fatalf("expected a %d error, got format %q and error %v", test.status, format, err)
+				}
+				return
+			}
+
+			if err != nil || format != test.format {
+				t.Fatalf("got format %q and error %v, want %q", format, err, test.format)
+			}
+		})
+	}
+}
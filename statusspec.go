@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// The HTTP status codes a test case expects, as a comma separated list of
+// exact codes (201), ranges (200-299) and classes (4xx), e.g. "400,422" or "2xx".
+// Plain codes are read and written as numbers so existing test cases keep working.
+type StatusSpec string
+
+// Check whether the status code satisfies any part of the spec
+func (spec StatusSpec) Matches(status int) bool {
+
+	for _, part := range strings.Split(string(spec), ",") {
+		low, high, err := parseStatusRange(strings.TrimSpace(part))
+		if err == nil && status >= low && status <= high {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check that every part of the spec is a code, range or class
+func (spec StatusSpec) Validate() error {
+
+	if spec == "" {
+		return errors.New("expected status is required")
+	}
+
+	for _, part := range strings.Split(string(spec), ",") {
+		if _, _, err := parseStatusRange(strings.TrimSpace(part)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Parse one part of a spec into the inclusive range of status codes it covers
+func parseStatusRange(part string) (int, int, error) {
+
+	invalid := fmt.Errorf("invalid expected status %q", part)
+
+	// A class such as 4xx
+	if len(part) == 3 && strings.EqualFold(part[1:], "xx") {
+		class, err := strconv.Atoi(part[:1])
+		if err != nil || class < 1 || class > 5 {
+			return 0, 0, invalid
+		}
+		return class * 100, class*100 + 99, nil
+	}
+
+	// A range such as 200-299
+	if i := strings.Index(part, "-"); i >= 0 {
+		low, err := parseStatusCode(part[:i])
+		if err != nil {
+			return 0, 0, invalid
+		}
+		high, err := parseStatusCode(part[i+1:])
+		if err != nil || high < low {
+			return 0, 0, invalid
+		}
+		return low, high, nil
+	}
+
+	code, err := parseStatusCode(part)
+	if err != nil {
+		return 0, 0, invalid
+	}
+	return code, code, nil
+}
+
+func parseStatusCode(code string) (int, error) {
+
+	status, err := strconv.Atoi(strings.TrimSpace(code))
+	if err != nil {
+		return 0, err
+	}
+
+	if status < 100 || status > 599 {
+		return 0, errors.New("status code out of range")
+	}
+
+	return status, nil
+}
+
+// A spec consisting of a single status code, as stored before specs existed
+func (spec StatusSpec) singleCode() (int, bool) {
+	code, err := strconv.Atoi(string(spec))
+	return code, err == nil
+}
+
+func (spec StatusSpec) MarshalJSON() ([]byte, error) {
+	if code, ok := spec.singleCode(); ok {
+		return json.Marshal(code)
+	}
+	return json.Marshal(string(spec))
+}
+
+func (spec *StatusSpec) UnmarshalJSON(data []byte) error {
+
+	var code int
+	if err := json.Unmarshal(data, &code); err == nil {
+		*spec = StatusSpec(strconv.Itoa(code))
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return errors.New("expected status must be a number or a string")
+	}
+
+	*spec = StatusSpec(value)
+	return nil
+}
+
+func (spec StatusSpec) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if code, ok := spec.singleCode(); ok {
+		return bsontype.Int32, bsoncore.AppendInt32(nil, int32(code)), nil
+	}
+	return bsontype.String, bsoncore.AppendString(nil, string(spec)), nil
+}
+
+func (spec *StatusSpec) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+
+	value := bsoncore.Value{Type: t, Data: data}
+
+	if code, ok := value.AsInt64OK(); ok {
+		*spec = StatusSpec(strconv.FormatInt(code, 10))
+		return nil
+	}
+
+	if str, ok := value.StringValueOK(); ok {
+		*spec = StatusSpec(str)
+		return nil
+	}
+
+	return fmt.Errorf("cannot decode expected status from BSON type %s", t)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var testSuiteColumns = []string{
+	"test_case_id", "test_case", "url", "methods", "expected_status", "optional",
+	"criterion", "source", "attribute", "operator", "expected_value", "expected_type",
+}
+
+// One row per predicate of each test case, with the predicate group as a single criterion.
+// A test case without criteria still gets a row of its own.
+func testSuiteRows(testSuite TestSuite) [][]string {
+
+	var rows [][]string
+
+	for _, testCase := range testSuite.TestCases {
+
+		testCaseColumns := []string{
+			testCase.Id.Hex(),
+			testCase.Name,
+			testCase.Url,
+			strings.Join(testCase.Methods, ", "),
+			string(testCase.ExpectedStatus),
+			strconv.FormatBool(testCase.Optional),
+		}
+
+		var criteria [][]string
+		for _, predicate := range testCase.Predicates {
+			criteria = append(criteria, []string{
+				prettyFormatPredicate(predicate),
+				predicateSource(predicate),
+				predicate.Attribute,
+				predicateOperator(predicate),
+				predicate.ExpectedValue,
+				predicate.ExpectedType,
+			})
+		}
+		if testCase.PredicateGroup != nil {
+			criteria = append(criteria, []string{prettyFormatPredicateGroup(testCase.PredicateGroup), "", "", "", "", ""})
+		}
+		if len(criteria) == 0 {
+			criteria = append(criteria, []string{"", "", "", "", "", ""})
+		}
+
+		for _, criterion := range criteria {
+			rows = append(rows, append(append([]string{}, testCaseColumns...), criterion...))
+		}
+	}
+
+	return rows
+}
+
+var testRunReportColumns = []string{
+	"test_case_id", "test_case", "url", "methods", "expected_status", "optional", "status",
+	"num_attempts", "first_pass_success", "first_attempt_at", "first_success_at",
+	"last_attempt_at", "time_to_first_success_seconds", "transaction_id", "transaction_status",
+}
+
+// One row per test case with its status and attempt history
+func testRunReportRows(testRunReport TestRunReport) [][]string {
+
+	var rows [][]string
+
+	for _, testCaseReport := range testRunReport.TestCaseReports {
+
+		testCase := testCaseReport.TestCase
+
+		var firstAttemptAt, lastAttemptAt, firstSuccessAt, timeToFirstSuccess string
+		if len(testCaseReport.Attempts) > 0 {
+			firstAttemptAt = formatTimestamp(testCaseReport.Attempts[0].Timestamp)
+			lastAttemptAt = formatTimestamp(testCaseReport.Attempts[len(testCaseReport.Attempts)-1].Timestamp)
+		}
+		if testCaseReport.FirstSuccessAt != nil {
+			firstSuccessAt = formatTimestamp(*testCaseReport.FirstSuccessAt)
+			timeToFirstSuccess = strconv.FormatFloat(testCaseReport.TimeToFirstSuccess, 'f', -1, 64)
+		}
+
+		var transactionId, transactionStatus string
+		if testCaseReport.Transaction != nil {
+			transactionId = testCaseReport.Transaction.Id.Hex()
+			transactionStatus = strconv.Itoa(testCaseReport.Transaction.Status)
+		}
+
+		rows = append(rows, []string{
+			testCase.Id.Hex(),
+			testCase.Name,
+			testCase.Url,
+			strings.Join(testCase.Methods, ", "),
+			string(testCase.ExpectedStatus),
+			strconv.FormatBool(testCase.Optional),
+			testCaseReport.Status.String(),
+			strconv.Itoa(testCaseReport.NumAttempts),
+			strconv.FormatBool(testCaseReport.FirstPassSuccess),
+			firstAttemptAt,
+			firstSuccessAt,
+			lastAttemptAt,
+			timeToFirstSuccess,
+			transactionId,
+			transactionStatus,
+		})
+	}
+
+	return rows
+}
+
+func formatTimestamp(timestamp time.Time) string {
+	if timestamp.IsZero() {
+		return ""
+	}
+	return timestamp.UTC().Format(time.RFC3339)
+}
+
+func writeCsv(w io.Writer, columns []string, rows [][]string) error {
+	writer := csv.NewWriter(w)
+	writer.Write(columns)
+	writer.WriteAll(rows)
+	return writer.Error()
+}
+
+// Write the rows as a GitHub flavoured Markdown table
+func writeMarkdownTable(w io.Writer, columns []string, rows [][]string) {
+
+	writeMarkdownRow(w, columns)
+
+	separator := make([]string, len(columns))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	writeMarkdownRow(w, separator)
+
+	for _, row := range rows {
+		writeMarkdownRow(w, row)
+	}
+}
+
+func writeMarkdownRow(w io.Writer, cells []string) {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		cell = strings.ReplaceAll(cell, "|", "\\|")
+		escaped[i] = strings.ReplaceAll(cell, "\n", "<br>")
+	}
+	fmt.Fprintf(w, "| %s |\n", strings.Join(escaped, " | "))
+}
+
+func writeMarkdownSuite(testSuite TestSuite, w io.Writer) {
+	fmt.Fprintf(w, "# Test Suite: %s\n\n", testSuite.Name)
+	writeMarkdownTable(w, testSuiteColumns, testSuiteRows(testSuite))
+}
+
+func writeMarkdownReport(testRunReport TestRunReport, w io.Writer) {
+
+	title := "Test Run Report"
+	if testRunReport.TestSuite != nil {
+		title += ": " + testRunReport.TestSuite.Name
+	}
+	fmt.Fprintf(w, "# %s\n\n", title)
+
+	if testRun := testRunReport.TestRun; testRun != nil {
+		fmt.Fprintf(w, "- Test run: %s (%s)\n", testRun.Name, testRun.Id.Hex())
+	}
+	fmt.Fprintf(w, "- Status: %s\n", testRunReport.Status)
+	fmt.Fprintf(w, "- Test cases: %d\n", testRunReport.NumTestCases)
+	fmt.Fprintf(w, "- Attempted: %d\n", testRunReport.NumTestsAttempted)
+	fmt.Fprintf(w, "- Passed: %d\n\n", testRunReport.NumTestsPassed)
+
+	writeMarkdownTable(w, testRunReportColumns, testRunReportRows(testRunReport))
+}
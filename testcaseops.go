@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
@@ -20,6 +21,23 @@ func createTestCase(w http.ResponseWriter, r *http.Request) {
 	// we decode our body request params
 	_ = json.NewDecoder(r.Body).Decode(&testcase)
 
+	if err := testcase.ExpectedStatus.Validate(); err != nil {
+		SendError(NewErrorResponse(http.StatusBadRequest, err.Error()), w)
+		return
+	}
+
+	// Methods are matched case-insensitively, but store them in their usual form
+	for i, method := range testcase.Methods {
+		testcase.Methods[i] = strings.ToUpper(method)
+	}
+
+	if testcase.PredicateGroup != nil {
+		if err := validatePredicateGroup(testcase.PredicateGroup); err != nil {
+			SendError(err, w)
+			return
+		}
+	}
+
 	// insert our book model.
 	result, err := testcaseCollection.InsertOne(context.TODO(), testcase)
 
@@ -1,13 +1,13 @@
 package main
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/tidwall/gjson"
-
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
@@ -18,6 +18,12 @@ import (
 
 // Returns transactions for a given test run, ***in descending chronological order***
 func findTransactionsForTestRun(testRun TestRun) ([]Transaction, error) {
+	return findTransactionsForTestRunSince(testRun, primitive.NilObjectID)
+}
+
+// Returns transactions for a given test run newer than the transaction with the supplied id,
+// ***in descending chronological order***. A nil id returns every transaction.
+func findTransactionsForTestRunSince(testRun TestRun, lastTransactionId primitive.ObjectID) ([]Transaction, error) {
 
 	// JTE TODO filter also on ApiKey
 
@@ -25,7 +31,10 @@ func findTransactionsForTestRun(testRun TestRun) ([]Transaction, error) {
 	findOptions := options.Find()
 	findOptions.SetSort(bson.D{{"_id", -1}})
 
-	filter := bson.D{{"testrunid", bson.D{{"$eq", testRun.TestRunHeaderId}}}}
+	filter := bson.M{"testrunid": testRun.TestRunHeaderId}
+	if !lastTransactionId.IsZero() {
+		filter["_id"] = bson.M{"$gt": lastTransactionId}
+	}
 
 	cursor, err := txCollection.Find(ctx, filter, findOptions)
 	if err != nil {
@@ -40,23 +49,117 @@ func findTransactionsForTestRun(testRun TestRun) ([]Transaction, error) {
 	return transactions, nil
 }
 
-// Check whether all the specified predicates match the given transaction
-func validatePredicatesForTransaction(predicates []*TestCasePredicate, transaction Transaction) bool {
+// Transaction ids are generated by clients before the insert commits, so a transaction can be
+// stored after one with a higher id has already been evaluated. Incremental evaluations look
+// this far back from the most recent transaction for any they have not yet taken into account.
+const TRANSACTION_GRACE_PERIOD = 5 * time.Minute
+
+// The lowest id an incremental evaluation of the run looks at again
+func transactionWindowStart(lastTransactionId primitive.ObjectID) primitive.ObjectID {
+
+	// Only the leading timestamp is set, so that every id generated in that second is included
+	var windowStart primitive.ObjectID
+	binary.BigEndian.PutUint32(windowStart[0:4], uint32(lastTransactionId.Timestamp().Add(-TRANSACTION_GRACE_PERIOD).Unix()))
+
+	return windowStart
+}
+
+// Returns the transactions for a given test run that its last evaluation did not take into
+// account, ***in descending chronological order***
+func findUnseenTransactions(testRun TestRun) ([]Transaction, error) {
+
+	since := primitive.NilObjectID
+	if !testRun.LastTransactionId.IsZero() {
+		since = transactionWindowStart(testRun.LastTransactionId)
+	}
+
+	transactions, err := findTransactionsForTestRunSince(testRun, since)
+	if err != nil {
+		return nil, err
+	}
+
+	return unseenTransactions(testRun, transactions), nil
+}
+
+// Drop the transactions the run has already taken into account
+func unseenTransactions(testRun TestRun, transactions []Transaction) []Transaction {
+
+	seen := make(map[primitive.ObjectID]bool)
+	for _, id := range testRun.RecentTransactionIds {
+		seen[id] = true
+	}
+
+	var unseen []Transaction
+	for _, transaction := range transactions {
+
+		// Runs evaluated before recent ids were recorded have seen everything up to the last one
+		if testRun.RecentTransactionIds == nil && transaction.Id.Hex() <= testRun.LastTransactionId.Hex() {
+			continue
+		}
+
+		if !seen[transaction.Id] {
+			unseen = append(unseen, transaction)
+		}
+	}
+
+	return unseen
+}
+
+// Record that the transactions have been taken into account, forgetting the ids that have
+// fallen out of the grace period
+func recordSeenTransactions(testRun *TestRun, transactions []Transaction) {
+
+	ids := testRun.RecentTransactionIds
+	for _, transaction := range transactions {
+		if transaction.Id.Hex() > testRun.LastTransactionId.Hex() {
+			testRun.LastTransactionId = transaction.Id
+		}
+		ids = append(ids, transaction.Id)
+	}
+
+	windowStart := transactionWindowStart(testRun.LastTransactionId).Hex()
+
+	recent := []primitive.ObjectID{}
+	for _, id := range ids {
+		if id.Hex() > windowStart {
+			recent = append(recent, id)
+		}
+	}
+	testRun.RecentTransactionIds = recent
+}
+
+// Check whether all the test case's predicates, and its predicate group if any, match the given transaction
+func validatePredicatesForTransaction(testCase TestCase, transaction Transaction) bool {
 
 	// Iterate through all predicates in this test case
 	allMatched := true
-	for _, predicate := range predicates {
-		if !matchPredicate(transaction.Request, predicate.Attribute, predicate.ExpectedValue) {
+	for _, predicate := range testCase.Predicates {
+		if !matchPredicate(transaction, predicate) {
 			allMatched = false
 			break
 		}
 	}
 
+	if allMatched && testCase.PredicateGroup != nil {
+		allMatched = matchPredicateGroup(transaction, testCase.PredicateGroup)
+	}
+
 	return allMatched
 }
 
+// Strip any query string from the URL
+func urlPath(url string) string {
+	if i := strings.Index(url, "?"); i >= 0 {
+		return url[:i]
+	}
+	return url
+}
+
 func urlMatches(url string, urlPattern string) bool {
 
+	// Query parameters are matched by predicates, not by the URL pattern
+	url = urlPath(url)
+
 	// Check for exact match
 	if url == urlPattern {
 		return true
@@ -68,53 +171,107 @@ func urlMatches(url string, urlPattern string) bool {
 	return ok
 }
 
-// Find the most recent transaction that matches this test case
-func matchTransactionToTestCase(testCase TestCase, transactions []Transaction) (Transaction, TestStatus, error) {
+// Check whether the transaction's HTTP method is one of those the test case accepts.
+// A test case with no methods, or with the "*" wildcard, accepts any method.
+func methodMatches(method string, methods []string) bool {
+
+	if len(methods) == 0 {
+		return true
+	}
+
+	for _, allowed := range methods {
+		if allowed == "*" || strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Find the most recent transaction that matches this test case, along with every attempt at it
+// in chronological order
+func matchTransactionToTestCase(testCase TestCase, transactions []Transaction) (Transaction, TestStatus, []*TestAttempt, error) {
 
 	var err error
 	var matchingTransaction Transaction
+	var attempts []*TestAttempt
 	testStatus := NotAttempted
 
 	for _, transaction := range transactions {
 
-		// Check whether URL matches
+		// Check whether URL and method match
 		// if transaction.Url != testCase.Url {
-		if !urlMatches(transaction.Url, testCase.Url) {
+		if !urlMatches(transaction.Url, testCase.Url) || !methodMatches(transaction.Method, testCase.Methods) {
 			continue // nope - this is not the transaction we want
 		}
 
 		// So far, so good - now attempt to match all predicates
-		if validatePredicatesForTransaction(testCase.Predicates, transaction) {
+		if validatePredicatesForTransaction(testCase, transaction) {
 
-			if transaction.Status == testCase.ExpectedStatus {
-				testStatus = Success
-			} else {
-				testStatus = Failure
+			attemptStatus := Failure
+			if testCase.ExpectedStatus.Matches(transaction.Status) {
+				attemptStatus = Success
 			}
 
-			// This transaction matches all checks, so don't need to keep looking
-			matchingTransaction = transaction
-
-			// Actually, break only if this transaction was successful, otherwise keep looking for successful match
-			if testStatus == Success {
-				break
+			attempts = append(attempts, &TestAttempt{
+				TransactionId:     transaction.Id,
+				Status:            attemptStatus,
+				TransactionStatus: transaction.Status,
+				Timestamp:         transactionTime(transaction),
+			})
+
+			// Keep the most recent successful transaction, otherwise keep looking for a successful match
+			if testStatus != Success {
+				testStatus = attemptStatus
+				matchingTransaction = transaction
 			}
 		}
 	}
 
+	// Transactions are most recent first; attempts are recorded oldest first
+	for i, j := 0, len(attempts)-1; i < j; i, j = i+1, j-1 {
+		attempts[i], attempts[j] = attempts[j], attempts[i]
+	}
+
 	// If test status is still undefined, then we did not find a matching transaction
 	// if testStatus == UndefinedTestStatus {
 	// 	err = errors.New("Could not find transaction to match test case " + testCase.Name)
 	// }
 
-	return matchingTransaction, testStatus, err
+	return matchingTransaction, testStatus, attempts, err
+}
+
+// When the transaction was made; transactions written before timestamps were stamped
+// server-side fall back to the creation time of their id
+func transactionTime(transaction Transaction) time.Time {
+	if transaction.Timestamp.IsZero() {
+		return transaction.Id.Timestamp()
+	}
+	return transaction.Timestamp
+}
+
+// Record the attempts on the test result and derive the attempt statistics from them
+func summarizeAttempts(testResult *TestResult, attempts []*TestAttempt, testRunStarted time.Time) {
+
+	testResult.Attempts = attempts
+	testResult.NumAttempts = len(attempts)
+	testResult.FirstPassSuccess = len(attempts) > 0 && attempts[0].Status == Success
+	testResult.FirstSuccessAt = nil
+	testResult.TimeToFirstSuccess = 0
+
+	for _, attempt := range attempts {
+		if attempt.Status == Success {
+			firstSuccessAt := attempt.Timestamp
+			testResult.FirstSuccessAt = &firstSuccessAt
+			testResult.TimeToFirstSuccess = firstSuccessAt.Sub(testRunStarted).Seconds()
+			break
+		}
+	}
 }
 
 // Match transactions to each test case in this test run instance
 func matchTransactionsToTestRun(testRun *TestRun, transactions []Transaction) error {
 
-	testRunStatus := Complete
-
 	// Zero out previous matching results
 	testRun.TestResults = nil
 
@@ -122,22 +279,44 @@ func matchTransactionsToTestRun(testRun *TestRun, transactions []Transaction) er
 	for _, testCase := range testRun.TestSuite.TestCases {
 
 		fmt.Println("Searching for transactions to match test case", testCase.Name)
-		transaction, testStatus, err := matchTransactionToTestCase(*testCase, transactions)
+		transaction, testStatus, attempts, err := matchTransactionToTestCase(*testCase, transactions)
 
 		if err == nil {
 			fmt.Println("Found matching transaction")
 			testResult := TestResult{ /*TestRun: testRun, */ TestCase: testCase, Status: testStatus, Transaction: &transaction, Timestamp: time.Now()}
+			summarizeAttempts(&testResult, attempts, testRun.Timestamp)
 			testRun.TestResults = append(testRun.TestResults, &testResult)
 		} else {
 			// Did not find a transaction to match this test case
 			fmt.Println("Did not find matching transaction")
 			testResult := TestResult{ /*TestRun: testRun, */ TestCase: testCase, Status: testStatus, Transaction: &transaction, Timestamp: time.Now()}
+			summarizeAttempts(&testResult, attempts, testRun.Timestamp)
 			testRun.TestResults = append(testRun.TestResults, &testResult)
-			testRunStatus = InProgress
 		}
 	}
 
-	testRun.Status = testRunStatus
+	// Record the transactions that did not match any test case
+	testRun.UnmatchedTransactions = findUnmatchedTransactions(testRun.TestSuite, transactions)
+
+	// Suggest the transactions that came closest to the test cases nobody has attempted
+	for _, testResult := range testRun.TestResults {
+		if testResult.Status == NotAttempted {
+			testResult.NearMisses = findNearMisses(*testResult.TestCase, transactions)
+		}
+	}
+
+	// Later evaluations need only consider transactions they have not seen
+	if len(transactions) > 0 {
+		if transactions[0].Id != testRun.LastTransactionId {
+			testRun.Reopened = false
+		}
+		testRun.LastTransactionId = transactions[0].Id
+	}
+	testRun.RecentTransactionIds = nil
+	recordSeenTransactions(testRun, transactions)
+
+	// Move the run along its lifecycle now the results are known
+	testRun.Status = nextTestRunStatus(*testRun, time.Now())
 
 	return nil
 }
@@ -146,20 +325,12 @@ func cleanse(input string) string {
 	return strings.Trim(input, "\"")
 }
 
-func matchPredicate(requestString string, predicate string, expectedValue string) bool {
+func matchPredicate(transaction Transaction, predicate *TestCasePredicate) bool {
 
-	value := gjson.Get(requestString, predicate)
+	value := predicateValue(transaction, predicate)
 
-	if value.Raw == "" {
-		return false //, errors.New("Predicate not found")
-	}
-
-	if strings.ToLower(cleanse(value.Raw)) == strings.ToLower(expectedValue) {
-		return true //, nil
-	} else {
-		return false //, errors.New("Expected value not matched")
-	}
-	// Should never get here
+	// Apply the predicate's operator; missing values only satisfy `notExists`
+	return compareValue(value, predicate)
 }
 
 // JTE WARNING: This is super inefficient
@@ -176,54 +347,55 @@ func getTestResultforTestCase(testCase TestCase, testRun TestRun) (TestResult, e
 	return TestResult{}, errors.New("Could not find a test result for test case " + testCase.Name)
 }
 
-func persistTestRun(testRun TestRun) error {
+// Update the results of the test run in place. The update only applies if the stored run is
+// still at the version that was loaded, so concurrent writers cannot overwrite each other;
+// the loser gets a 409 Conflict. On success the version of the supplied run is advanced.
+func persistTestRun(testRun *TestRun) error {
+	return testRunStore.SaveTestRun(testRun)
+}
+
+func fetchTestRun(testRunId string) (TestRun, error) {
+
+	// string to primitive.ObjectID
+	id, _ := primitive.ObjectIDFromHex(testRunId)
 
-	// TODO JTE is there a better way to update this document in place?
-	// What's being updated is the array of TestResults and maybe the status
+	// Get specified test run from the store
+	testRun, err := testRunStore.LoadTestRun(id)
 
-	_, err := testrunCollection.DeleteOne(ctx, bson.M{"_id": testRun.Id})
 	if err != nil {
-		return err
+		return TestRun{}, err
 	}
 
-	// TODO JTE check whether the test run is complete
-	// if len(testRun.TestResults) == len(testRun.TestSuite.TestCases) {
-	// 	testRun.Status = Complete
-	// } else {
-	// 	testRun.Status = InProgress
-	// }
+	// Load the Test Suite for this Test Run
+	return loadTestSuite(testRun, ctx)
+}
 
-	// TODO JTE Warning: setting the status of the run to Complete always
-	testRun.Status = Complete
+// Match all of the test run's transactions to its test cases
+func matchTestRun(testRun *TestRun) error {
 
-	_, err = testrunCollection.InsertOne(ctx, testRun)
+	// Find all the transactions submitted against this test run
+	transactions, err := findTransactionsForTestRun(*testRun)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// Match transactions to test cases; update TestRun instance
+	return matchTransactionsToTestRun(testRun, transactions)
 }
 
-func fetchTestRun(testRunId string) (TestRun, error) {
-
-	// The return value
-	var testRun TestRun
-
-	// Get specified test run from database
-
-	// string to primitive.ObjectID
-	id, _ := primitive.ObjectIDFromHex(testRunId)
-
-	// We create filter. If it is unnecessary to sort data for you, you can use bson.M{}
-	filter := bson.M{"_id": id}
-	err := testrunCollection.FindOne(ctx, filter).Decode(&testRun)
+// Match the test run's transactions to its test cases without persisting anything
+func evaluateTestRun(testRunId string) (TestRun, error) {
 
+	// Load the test run with the specified id from db
+	testRun, err := fetchTestRun(testRunId)
 	if err != nil {
 		return TestRun{}, err
 	}
 
-	// Load the Test Suite for this Test Run
-	testRun, err = loadTestSuite(testRun, ctx)
+	err = matchTestRun(&testRun)
+	if err != nil {
+		return TestRun{}, err
+	}
 
 	return testRun, nil
 }
@@ -236,20 +408,16 @@ func collectTestRun(testRunId string) (TestRun, error) {
 		return TestRun{}, err
 	}
 
-	// Find all the transactions submitted against this test run
-	transactions, err := findTransactionsForTestRun(testRun)
-	if err != nil {
-		return TestRun{}, err
-	}
+	before := snapshotTestRun(testRun)
 
-	// Match transactions to test cases; update TestRun instance
-	err = matchTransactionsToTestRun(&testRun, transactions)
+	// Match transactions to the test run
+	err = matchTestRun(&testRun)
 	if err != nil {
 		return TestRun{}, err
 	}
 
 	// Persist the test run instance to db
-	err = persistTestRun(testRun)
+	err = saveTestRunChanges(before, &testRun)
 
 	return testRun, err
 }
@@ -257,6 +425,7 @@ func collectTestRun(testRunId string) (TestRun, error) {
 func compileTestRunReport(testRun TestRun) (TestRunReport, error) {
 
 	testRunReport := TestRunReport{TestSuite: testRun.TestSuite, TestRun: &testRun, Status: testRun.Status}
+	testRunReport.UnmatchedTransactions = testRun.UnmatchedTransactions
 	testRunReport.TestCaseReports = make([]TestCaseReport, len(testRun.TestSuite.TestCases))
 
 	numSuccess := 0
@@ -278,6 +447,16 @@ func compileTestRunReport(testRun TestRun) (TestRunReport, error) {
 		// }
 
 		testCaseReport := TestCaseReport{TestCase: testCase, Status: testStatus}
+		testCaseReport.Attempts = testResult.Attempts
+		testCaseReport.NumAttempts = testResult.NumAttempts
+		testCaseReport.FirstPassSuccess = testResult.FirstPassSuccess
+		testCaseReport.FirstSuccessAt = testResult.FirstSuccessAt
+		testCaseReport.TimeToFirstSuccess = testResult.TimeToFirstSuccess
+		if testStatus == NotAttempted {
+			testCaseReport.NearMisses = testResult.NearMisses
+		} else {
+			testCaseReport.Transaction = testResult.Transaction
+		}
 		//testRunReport.TestCaseReports = append(testRunReport.TestCaseReports, testCaseReport)
 		testRunReport.TestCaseReports[i] = testCaseReport
 	}
@@ -288,3 +467,50 @@ func compileTestRunReport(testRun TestRun) (TestRunReport, error) {
 
 	return testRunReport, nil
 }
+
+// Find the transactions that match none of the suite's test cases on URL, method and predicates,
+// grouped by URL with the most frequently hit URLs first
+func findUnmatchedTransactions(testSuite *TestSuite, transactions []Transaction) []*UnmatchedTransactionGroup {
+
+	var groups []*UnmatchedTransactionGroup
+	groupsByUrl := make(map[string]*UnmatchedTransactionGroup)
+
+	for _, transaction := range transactions {
+
+		matched := false
+		for _, testCase := range testSuite.TestCases {
+			if urlMatches(transaction.Url, testCase.Url) &&
+				methodMatches(transaction.Method, testCase.Methods) &&
+				validatePredicatesForTransaction(*testCase, transaction) {
+				matched = true
+				break
+			}
+		}
+
+		if matched {
+			continue
+		}
+
+		url := urlPath(transaction.Url)
+		group, ok := groupsByUrl[url]
+		if !ok {
+			group = &UnmatchedTransactionGroup{Url: url}
+			groupsByUrl[url] = group
+			groups = append(groups, group)
+		}
+
+		group.Count++
+		group.Transactions = append(group.Transactions, UnmatchedTransaction{
+			TransactionId: transaction.Id,
+			Method:        transaction.Method,
+			Status:        transaction.Status,
+			Timestamp:     transactionTime(transaction),
+		})
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Count > groups[j].Count
+	})
+
+	return groups
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Types of event published about a test run
+const (
+	EventTransaction = "transaction"
+	EventResult      = "result"
+	EventStatus      = "status"
+)
+
+type TestRunEvent struct {
+	Type      string             `json:"type"`
+	TestRunId primitive.ObjectID `json:"test_run_id"`
+	Timestamp time.Time          `json:"timestamp"`
+
+	// Set for transaction events
+	Transaction *Transaction `json:"transaction,omitempty"`
+
+	// Set for result events
+	TestCase           *TestCase  `json:"test_case,omitempty"`
+	TestStatus         TestStatus `json:"test_status,omitempty"`
+	PreviousTestStatus TestStatus `json:"previous_test_status,omitempty"`
+
+	// Set for status events
+	RunStatus         TestRunStatus `json:"run_status,omitempty"`
+	PreviousRunStatus TestRunStatus `json:"previous_run_status,omitempty"`
+}
+
+// What a test run looked like when it was loaded, so that changes can be detected when it is saved
+type testRunSnapshot struct {
+	Status               TestRunStatus
+	LastTransactionId    primitive.ObjectID
+	RecentTransactionIds []primitive.ObjectID
+	TestStatuses         map[primitive.ObjectID]TestStatus
+}
+
+func snapshotTestRun(testRun TestRun) testRunSnapshot {
+
+	snapshot := testRunSnapshot{
+		Status:               testRun.Status,
+		LastTransactionId:    testRun.LastTransactionId,
+		RecentTransactionIds: testRun.RecentTransactionIds,
+		TestStatuses:         make(map[primitive.ObjectID]TestStatus),
+	}
+
+	for _, testResult := range testRun.TestResults {
+		snapshot.TestStatuses[testResult.TestCase.Id] = testResult.Status
+	}
+
+	return snapshot
+}
+
+// Persist the test run and then publish whatever changed since the snapshot was taken
+func saveTestRunChanges(before testRunSnapshot, testRun *TestRun) error {
+
+	if err := persistTestRun(testRun); err != nil {
+		return err
+	}
+
+	notifyTestRunChanges(before, *testRun)
+	return nil
+}
+
+// Publish an event for each transaction taken into account, each test result whose status
+// changed and the run's own status change, in that order. Result and status changes are
+// also sent to any interested webhooks.
+func notifyTestRunChanges(before testRunSnapshot, testRun TestRun) {
+
+	now := time.Now()
+
+	// Recent ids are only ever added to unless the last transaction moves on
+	seenTransactions := testRun.LastTransactionId != before.LastTransactionId ||
+		len(testRun.RecentTransactionIds) != len(before.RecentTransactionIds)
+
+	if seenTransactions && testRunEvents.hasSubscribers(testRun.Id) {
+		previous := testRun
+		previous.LastTransactionId = before.LastTransactionId
+		previous.RecentTransactionIds = before.RecentTransactionIds
+
+		transactions, err := findUnseenTransactions(previous)
+		if err != nil {
+			log.Println("Could not load transactions for test run events:", err.Error())
+		}
+
+		seen := make(map[primitive.ObjectID]bool)
+		for _, id := range testRun.RecentTransactionIds {
+			seen[id] = true
+		}
+		windowStart := transactionWindowStart(testRun.LastTransactionId).Hex()
+
+		// Oldest first, skipping any that arrived after this evaluation
+		for i := len(transactions) - 1; i >= 0; i-- {
+			transaction := transactions[i]
+			if seen[transaction.Id] || transaction.Id.Hex() <= windowStart {
+				testRunEvents.publish(TestRunEvent{Type: EventTransaction, TestRunId: testRun.Id, Timestamp: now, Transaction: &transaction})
+			}
+		}
+	}
+
+	for _, testResult := range testRun.TestResults {
+		previous, ok := before.TestStatuses[testResult.TestCase.Id]
+		if !ok {
+			previous = NotAttempted
+		}
+
+		if testResult.Status != previous {
+			event := TestRunEvent{
+				Type:               EventResult,
+				TestRunId:          testRun.Id,
+				Timestamp:          now,
+				TestCase:           testResult.TestCase,
+				TestStatus:         testResult.Status,
+				PreviousTestStatus: previous,
+			}
+			testRunEvents.publish(event)
+			triggerWebhooks(testRun, event)
+		}
+	}
+
+	if testRun.Status != before.Status {
+		event := TestRunEvent{
+			Type:              EventStatus,
+			TestRunId:         testRun.Id,
+			Timestamp:         now,
+			RunStatus:         testRun.Status,
+			PreviousRunStatus: before.Status,
+		}
+		testRunEvents.publish(event)
+		triggerWebhooks(testRun, event)
+
+		if testRun.Status == Complete && allTestsPassed(testRun) {
+			if _, err := issueCertificate(testRun); err != nil {
+				log.Println("Could not issue certificate for test run", testRun.Id.Hex(), ":", err.Error())
+			}
+		}
+	}
+}
+
+// Number of events buffered for each subscriber; events for a subscriber that falls further
+// behind than this are dropped rather than holding up the publisher
+const EVENT_BUFFER_SIZE = 64
+
+// Fans events out to everybody subscribed to the test run they concern
+type testRunEventBroker struct {
+	mu          sync.Mutex
+	subscribers map[primitive.ObjectID]map[chan TestRunEvent]bool
+}
+
+var testRunEvents = &testRunEventBroker{subscribers: make(map[primitive.ObjectID]map[chan TestRunEvent]bool)}
+
+func (broker *testRunEventBroker) subscribe(testRunId primitive.ObjectID) chan TestRunEvent {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	events := make(chan TestRunEvent, EVENT_BUFFER_SIZE)
+
+	if broker.subscribers[testRunId] == nil {
+		broker.subscribers[testRunId] = make(map[chan TestRunEvent]bool)
+	}
+	broker.subscribers[testRunId][events] = true
+
+	return events
+}
+
+func (broker *testRunEventBroker) unsubscribe(testRunId primitive.ObjectID, events chan TestRunEvent) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	delete(broker.subscribers[testRunId], events)
+	if len(broker.subscribers[testRunId]) == 0 {
+		delete(broker.subscribers, testRunId)
+	}
+}
+
+func (broker *testRunEventBroker) hasSubscribers(testRunId primitive.ObjectID) bool {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	return len(broker.subscribers[testRunId]) > 0
+}
+
+func (broker *testRunEventBroker) publish(event TestRunEvent) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	for events := range broker.subscribers[event.TestRunId] {
+		select {
+		case events <- event:
+		default:
+			// Subscriber is not keeping up
+		}
+	}
+}
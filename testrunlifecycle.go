@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// The statuses a test run may move to from each status
+var testRunTransitions = map[TestRunStatus][]TestRunStatus{
+	Created:    {InProgress, Complete, Cancelled, Expired},
+	InProgress: {Complete, Cancelled, Expired},
+	Complete:   {InProgress},
+	Cancelled:  {InProgress},
+	Expired:    {InProgress},
+}
+
+// Check whether a test run may move from one status to another
+func canTransition(from TestRunStatus, to TestRunStatus) bool {
+
+	// Runs stored before statuses were enforced are treated as just created
+	if from == UndefinedRunStatus {
+		from = Created
+	}
+
+	for _, allowed := range testRunTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Move the test run to the supplied status, if that is a valid transition
+func transitionTestRun(testRun *TestRun, to TestRunStatus) error {
+
+	if !canTransition(testRun.Status, to) {
+		return NewErrorResponse(http.StatusConflict, "test run cannot move from "+testRun.Status.String()+" to "+to.String())
+	}
+
+	testRun.Status = to
+	return nil
+}
+
+// Complete, cancelled and expired runs only change status through explicit actions
+func isTerminal(status TestRunStatus) bool {
+	return status == Complete || status == Cancelled || status == Expired
+}
+
+func hasExpired(testRun TestRun, now time.Time) bool {
+	return testRun.ExpiresAt != nil && now.After(*testRun.ExpiresAt)
+}
+
+// New transactions are accepted until a run is cancelled or expires
+func acceptsTransactions(testRun TestRun, now time.Time) bool {
+	return testRun.Status != Cancelled && testRun.Status != Expired && !hasExpired(testRun, now)
+}
+
+// Work out the status a test run moves to automatically once its results have been matched.
+// A run completes only when every required test case has passed, and starts as soon as any
+// test case has been attempted.
+func nextTestRunStatus(testRun TestRun, now time.Time) TestRunStatus {
+
+	if isTerminal(testRun.Status) {
+		return testRun.Status
+	}
+
+	if hasExpired(testRun, now) {
+		return Expired
+	}
+
+	allRequiredPassed := true
+	anyAttempted := false
+
+	for _, testResult := range testRun.TestResults {
+		if testResult.Status == Success || testResult.Status == Failure {
+			anyAttempted = true
+		}
+		if !testResult.TestCase.Optional && testResult.Status != Success {
+			allRequiredPassed = false
+		}
+	}
+
+	switch {
+	case allRequiredPassed && len(testRun.TestResults) > 0 && !testRun.Reopened:
+		return Complete
+	case anyAttempted || testRun.Status == InProgress:
+		return InProgress
+	}
+
+	return Created
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // POST /dstestapi/testruns handler
@@ -20,9 +22,10 @@ func initTestRun(w http.ResponseWriter, r *http.Request) {
 	// we decode our body request params
 	_ = json.NewDecoder(r.Body).Decode(&testrun)
 
-	// Set timestamp and status
+	// Set timestamp, status and version
 	testrun.Timestamp = time.Now()
 	testrun.Status = Created
+	testrun.Version = 0
 
 	// insert our object
 	result, err := testrunCollection.InsertOne(ctx, testrun)
@@ -123,41 +126,34 @@ func getTestRun(w http.ResponseWriter, r *http.Request) {
 }
 
 // GET /dstestapi/testruns/{id}/report handler
+// Returns the latest stored evaluation, or the one given by ?evaluation={evaluationId}. The
+// worker stores a new evaluation whenever a run's results change, so the latest one is current.
+// A run that has never been evaluated is matched on the fly, without storing anything.
+// The report is JSON unless another format is asked for with ?format= or the Accept header.
 func getTestRunReport(w http.ResponseWriter, r *http.Request) {
 	// set header.
 	w.Header().Set("Content-Type", "application/json")
 
-	//var testrun TestRun
-
 	// we get params with mux.
 	var params = mux.Vars(r)
 
-	/*
-		// string to primitive.ObjectID
-		id, _ := primitive.ObjectIDFromHex(params["id"])
-
-		// We create filter. If it is unnecessary to sort data for you, you can use bson.M{}
-		filter := bson.M{"_id": id}
-		err := testrunCollection.FindOne(ctx, filter).Decode(&testrun)
+	evaluationId := r.URL.Query().Get("evaluation")
 
-		if err != nil {
-			//TODO assumption here is that the error is `not found`
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
+	evaluation, err := fetchTestRunEvaluation(params["id"], evaluationId)
 
-		// Load the Test Suite for this Test Run
-		testrun, err = loadTestSuite(testrun, ctx)
+	if err == nil {
+		writeTestRunReport(*evaluation.Report, w, r)
+		return
+	}
 
-		if err != nil {
-			//TODO assumption here is that the error is `not found`
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-	*/
+	if err != mongo.ErrNoDocuments || evaluationId != "" {
+		//TODO assumption here is that the error is `not found`
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 
-	// Perform matching of transactions against test suite
-	testrun, err := collectTestRun(params["id"])
+	// Perform matching of transactions against test suite, without persisting the results
+	testrun, err := evaluateTestRun(params["id"])
 
 	if err != nil {
 		//TODO assumption here is that the error is `not found`
@@ -167,7 +163,180 @@ func getTestRunReport(w http.ResponseWriter, r *http.Request) {
 
 	testRunReport, _ := compileTestRunReport(testrun)
 	// JTE TODO handle error
-	json.NewEncoder(w).Encode(testRunReport)
+	writeTestRunReport(testRunReport, w, r)
+}
+
+// POST /dstestapi/testruns/{id}/evaluate handler
+func evaluateTestRunHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// get params
+	var params = mux.Vars(r)
+
+	// Perform matching of transactions against test suite and persist the results
+	testrun, err := collectTestRun(params["id"])
+
+	if err == mongo.ErrNoDocuments {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	evaluation, err := storeTestRunEvaluation(testrun)
+
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(evaluation)
+}
+
+// GET /dstestapi/testruns/{id}/evaluations handler
+func getTestRunEvaluations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// get params
+	var params = mux.Vars(r)
+
+	evaluations, err := fetchTestRunEvaluations(params["id"])
+
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(evaluations)
+}
+
+// GET /dstestapi/testruns/{id}/testcases/{caseId}/explain handler
+func getTestCaseExplanation(w http.ResponseWriter, r *http.Request) {
+	// set header.
+	w.Header().Set("Content-Type", "application/json")
+
+	// we get params with mux.
+	var params = mux.Vars(r)
+
+	testRun, err := fetchTestRun(params["id"])
+
+	if err != nil || testRun.TestSuite == nil {
+		//TODO assumption here is that the error is `not found`
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// string to primitive.ObjectID
+	caseId, _ := primitive.ObjectIDFromHex(params["caseId"])
+
+	var testCase *TestCase
+	for _, candidate := range testRun.TestSuite.TestCases {
+		if candidate.Id == caseId {
+			testCase = candidate
+			break
+		}
+	}
+
+	if testCase == nil {
+		SendError(NewErrorResponse(http.StatusNotFound, "test case "+params["caseId"]+" is not part of this test run"), w)
+		return
+	}
+
+	transactions, err := findTransactionsForTestRun(testRun)
+
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(explainTestCase(testRun, *testCase, transactions))
+}
+
+// GET /dstestapi/testruns/{id}/unmatched handler
+func getUnmatchedTransactions(w http.ResponseWriter, r *http.Request) {
+	// set header.
+	w.Header().Set("Content-Type", "application/json")
+
+	// we get params with mux.
+	var params = mux.Vars(r)
+
+	testRun, err := fetchTestRun(params["id"])
+
+	if err != nil || testRun.TestSuite == nil {
+		//TODO assumption here is that the error is `not found`
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	transactions, err := findTransactionsForTestRun(testRun)
+
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	unmatched := findUnmatchedTransactions(testRun.TestSuite, transactions)
+	if unmatched == nil {
+		unmatched = []*UnmatchedTransactionGroup{}
+	}
+
+	json.NewEncoder(w).Encode(unmatched)
+}
+
+// How often a comment is sent down an idle event stream to keep the connection open
+const EVENT_STREAM_HEARTBEAT = 15 * time.Second
+
+// GET /dstestapi/testruns/{id}/events handler
+// Streams TestRunEvents for the run as Server-Sent Events until the client disconnects
+func getTestRunEvents(w http.ResponseWriter, r *http.Request) {
+
+	// we get params with mux.
+	var params = mux.Vars(r)
+
+	// string to primitive.ObjectID
+	id, _ := primitive.ObjectIDFromHex(params["id"])
+
+	count, err := testrunCollection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		SendError(err, w)
+		return
+	} else if count == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		SendError(NewErrorResponse(http.StatusInternalServerError, "streaming is not supported"), w)
+		return
+	}
+
+	events := testRunEvents.subscribe(id)
+	defer testRunEvents.unsubscribe(id, events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(EVENT_STREAM_HEARTBEAT)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprintf(w, ": heartbeat\n\n")
+		case event := <-events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		flusher.Flush()
+	}
 }
 
 // DELETE /dstestapi/testruns/{id} handler
@@ -194,21 +363,91 @@ func deleteTestRun(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(deleteResult)
 }
 
-// POST /dstestapi/testruns/:id/stop handler
-/*
+// POST /dstestapi/testruns/{id}/stop handler
+// Evaluates the run one last time and marks it Complete, whether or not every test case passed
 func stopTestRun(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// get params
 	var params = mux.Vars(r)
 
-	testRun, err := collectTestRun(params["id"])
+	testRun, err := fetchTestRun(params["id"])
+	before := snapshotTestRun(testRun)
 
-	if err != nil {
-		GetError(err, w)
+	if err == nil {
+		err = matchTestRun(&testRun)
+	}
+
+	if err == nil && testRun.Status != Complete {
+		err = transitionTestRun(&testRun, Complete)
+	}
+
+	writeTestRunTransition(before, testRun, err, w)
+}
+
+// POST /dstestapi/testruns/{id}/cancel handler
+func cancelTestRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// get params
+	var params = mux.Vars(r)
+
+	testRun, err := fetchTestRun(params["id"])
+	before := snapshotTestRun(testRun)
+
+	if err == nil {
+		err = transitionTestRun(&testRun, Cancelled)
+	}
+
+	writeTestRunTransition(before, testRun, err, w)
+}
+
+// POST /dstestapi/testruns/{id}/reopen handler
+func reopenTestRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// get params
+	var params = mux.Vars(r)
+
+	testRun, err := fetchTestRun(params["id"])
+	before := snapshotTestRun(testRun)
+
+	if err == nil {
+		err = transitionTestRun(&testRun, InProgress)
+	}
+
+	// A reopened run that had expired no longer expires
+	if err == nil && hasExpired(testRun, time.Now()) {
+		testRun.ExpiresAt = nil
+	}
+
+	// Keep the worker from completing it again until new transactions arrive
+	if err == nil {
+		testRun.Reopened = true
+	}
+
+	writeTestRunTransition(before, testRun, err, w)
+}
+
+// Persist a test run whose status has just changed, along with an evaluation reflecting the
+// new status, and write it to the response
+func writeTestRunTransition(before testRunSnapshot, testRun TestRun, err error, w http.ResponseWriter) {
+
+	if err == nil {
+		err = saveTestRunChanges(before, &testRun)
+	}
+
+	if err == nil {
+		_, err = storeTestRunEvaluation(testRun)
+	}
+
+	if err == mongo.ErrNoDocuments {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		SendError(err, w)
 		return
 	}
 
 	json.NewEncoder(w).Encode(testRun)
 }
-*/
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Where test runs are loaded from and their results saved to
+type TestRunStore interface {
+	// Load the test run, or return mongo.ErrNoDocuments
+	LoadTestRun(id primitive.ObjectID) (TestRun, error)
+
+	// Save the run's results if the stored run is still at testRun.Version, advancing the
+	// version of both. Returns a 409 ErrorResponse if another writer got there first and
+	// mongo.ErrNoDocuments if the run has gone.
+	SaveTestRun(testRun *TestRun) error
+}
+
+// The store used by the API and the evaluation worker
+var testRunStore TestRunStore = mongoTestRunStore{}
+
+func testRunConflict(id primitive.ObjectID) error {
+	return NewErrorResponse(http.StatusConflict, "test run "+id.Hex()+" was modified concurrently; retry the request")
+}
+
+// Test runs held in the testruns collection
+type mongoTestRunStore struct{}
+
+func (mongoTestRunStore) LoadTestRun(id primitive.ObjectID) (TestRun, error) {
+
+	var testRun TestRun
+	err := testrunCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&testRun)
+
+	return testRun, err
+}
+
+func (mongoTestRunStore) SaveTestRun(testRun *TestRun) error {
+
+	// Runs stored before versioning was introduced have no version field, which matches null
+	filter := bson.M{"_id": testRun.Id, "version": testRun.Version}
+	if testRun.Version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"testresults":           testRun.TestResults,
+			"unmatchedtransactions": testRun.UnmatchedTransactions,
+			"status":                testRun.Status,
+			"expiresat":             testRun.ExpiresAt,
+			"lasttransactionid":     testRun.LastTransactionId,
+			"recenttransactionids":  testRun.RecentTransactionIds,
+			"reopened":              testRun.Reopened,
+		},
+		"$inc": bson.M{"version": 1},
+	}
+
+	result, err := testrunCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		// Either the run has gone, or somebody else updated it first
+		count, err := testrunCollection.CountDocuments(ctx, bson.M{"_id": testRun.Id})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return testRunConflict(testRun.Id)
+	}
+
+	testRun.Version++
+
+	return nil
+}
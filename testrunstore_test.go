@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Test runs held in memory, with the same version check as the Mongo store
+type memoryTestRunStore struct {
+	mu       sync.Mutex
+	testRuns map[primitive.ObjectID]TestRun
+}
+
+func newMemoryTestRunStore() *memoryTestRunStore {
+	return &memoryTestRunStore{testRuns: make(map[primitive.ObjectID]TestRun)}
+}
+
+// Add or replace a run as it is, without any version check
+func (store *memoryTestRunStore) PutTestRun(testRun TestRun) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.testRuns[testRun.Id] = testRun
+}
+
+func (store *memoryTestRunStore) LoadTestRun(id primitive.ObjectID) (TestRun, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	testRun, ok := store.testRuns[id]
+	if !ok {
+		return TestRun{}, mongo.ErrNoDocuments
+	}
+
+	return testRun, nil
+}
+
+func (store *memoryTestRunStore) SaveTestRun(testRun *TestRun) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.testRuns[testRun.Id]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	if stored.Version != testRun.Version {
+		return testRunConflict(testRun.Id)
+	}
+
+	stored.TestResults = testRun.TestResults
+	stored.UnmatchedTransactions = testRun.UnmatchedTransactions
+	stored.Status = testRun.Status
+	stored.ExpiresAt = testRun.ExpiresAt
+	stored.LastTransactionId = testRun.LastTransactionId
+	stored.RecentTransactionIds = testRun.RecentTransactionIds
+	stored.Reopened = testRun.Reopened
+	stored.Version++
+	store.testRuns[testRun.Id] = stored
+
+	testRun.Version++
+
+	return nil
+}
+
+// Holds every writer between loading the run and saving it until all of them have loaded it,
+// so that they all try to save the same version. Only one writer at a time runs in between,
+// as the mock deployment answers queries in the order its responses were added.
+type racingTestRunStore struct {
+	TestRunStore
+	loaded sync.WaitGroup
+	saving sync.WaitGroup
+	turn   chan struct{}
+}
+
+func newRacingTestRunStore(store TestRunStore, writers int) *racingTestRunStore {
+	racing := &racingTestRunStore{TestRunStore: store, turn: make(chan struct{}, 1)}
+	racing.loaded.Add(writers)
+	racing.saving.Add(writers)
+	return racing
+}
+
+func (store *racingTestRunStore) LoadTestRun(id primitive.ObjectID) (TestRun, error) {
+	testRun, err := store.TestRunStore.LoadTestRun(id)
+
+	store.loaded.Done()
+	store.loaded.Wait()
+
+	store.turn <- struct{}{}
+	return testRun, err
+}
+
+func (store *racingTestRunStore) SaveTestRun(testRun *TestRun) error {
+	<-store.turn
+
+	store.saving.Done()
+	store.saving.Wait()
+
+	return store.TestRunStore.SaveTestRun(testRun)
+}
+
+// Respond to the next query with the documents, as a collection would
+func addDocumentsResponse(mt *mtest.T, values ...interface{}) {
+
+	var documents []bson.D
+	for _, value := range values {
+		raw, err := bson.Marshal(value)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		var document bson.D
+		if err := bson.Unmarshal(raw, &document); err != nil {
+			mt.Fatal(err)
+		}
+		documents = append(documents, document)
+	}
+
+	mt.AddMockResponses(mtest.CreateCursorResponse(0, "dstest.collection", mtest.FirstBatch, documents...))
+}
+
+// Concurrent evaluations of one run all load the same version, so exactly one may save its
+// results and the rest must be answered with a 409 Conflict
+func TestConcurrentTestRunEvaluations(t *testing.T) {
+
+	const writers = 16
+	const rounds = 5
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("evaluate", func(mt *mtest.T) {
+		testsuiteCollection = mt.Coll
+		txCollection = mt.Coll
+		evaluationCollection = mt.Coll
+
+		defer func(store TestRunStore) { testRunStore = store }(testRunStore)
+
+		memoryStore := newMemoryTestRunStore()
+		testCase := &TestCase{Id: primitive.NewObjectID(), Name: "Create a payment", Url: "/payments", ExpectedStatus: "201"}
+		testSuite := TestSuite{Id: primitive.NewObjectID(), Name: "Payments", TestCases: []*TestCase{testCase}}
+		testRunId := primitive.NewObjectID()
+		memoryStore.PutTestRun(TestRun{Id: testRunId, TestRunHeaderId: "run-1", TestSuite: &TestSuite{Id: testSuite.Id}, Status: Created})
+
+		router := mux.NewRouter()
+		router.HandleFunc("/dstestapi/testruns/{id}/evaluations", evaluateTestRunHandler).Methods("POST")
+
+		for round := 0; round < rounds; round++ {
+
+			testRunStore = newRacingTestRunStore(memoryStore, writers)
+
+			// Each writer in turn loads the suite and the run's transactions; only the winner
+			// goes on to store an evaluation
+			for i := 0; i < writers; i++ {
+				addDocumentsResponse(mt, testSuite)
+				addDocumentsResponse(mt)
+			}
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+			var done sync.WaitGroup
+			statuses := make(chan int, writers)
+			bodies := make(chan []byte, writers)
+
+			done.Add(writers)
+			for i := 0; i < writers; i++ {
+				go func() {
+					defer done.Done()
+
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, httptest.NewRequest("POST", "/dstestapi/testruns/"+testRunId.Hex()+"/evaluations", nil))
+
+					statuses <- w.Code
+					bodies <- w.Body.Bytes()
+				}()
+			}
+			done.Wait()
+
+			created, conflicts := 0, 0
+			for i := 0; i < writers; i++ {
+				status, body := <-statuses, <-bodies
+				switch status {
+				case http.StatusCreated:
+					created++
+				case http.StatusConflict:
+					var response ErrorResponse
+					if err := json.Unmarshal(body, &response); err != nil || response.StatusCode != http.StatusConflict {
+						mt.Fatalf("round %d: conflict was not reported as an error response: %s", round, body)
+					}
+					conflicts++
+				default:
+					mt.Fatalf("round %d: unexpected status %d: %s", round, status, body)
+				}
+			}
+
+			if created != 1 || conflicts != writers-1 {
+				mt.Fatalf("round %d: %d evaluations were created and %d conflicted, want 1 and %d", round, created, conflicts, writers-1)
+			}
+
+			testRun, _ := memoryStore.LoadTestRun(testRunId)
+			if testRun.Version != int64(round+1) {
+				mt.Fatalf("round %d: version is %d, want %d", round, testRun.Version, round+1)
+			}
+		}
+	})
+}
+
+// The update only applies to the version that was loaded, and advances it
+func TestMongoTestRunStoreSave(t *testing.T) {
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("unversioned", func(mt *mtest.T) {
+		testrunCollection = mt.Coll
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"n", 1}, {"nModified", 1}})
+
+		testRun := TestRun{Id: primitive.NewObjectID(), Status: InProgress}
+		if err := (mongoTestRunStore{}).SaveTestRun(&testRun); err != nil {
+			mt.Fatal(err)
+		}
+		if testRun.Version != 1 {
+			mt.Fatalf("version is %d, want 1", testRun.Version)
+		}
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+
+		// Runs stored before versioning have no version at all
+		versions, ok := update.Lookup("q", "version", "$in").ArrayOK()
+		if !ok {
+			mt.Fatalf("filter does not match unversioned runs: %s", update.Lookup("q"))
+		}
+		if values, _ := versions.Values(); len(values) != 2 || values[0].Int32() != 0 || values[1].Type != bson.TypeNull {
+			mt.Fatalf("filter does not match version 0 or null: %s", versions)
+		}
+		if inc := update.Lookup("u", "$inc", "version").Int32(); inc != 1 {
+			mt.Fatalf("version is incremented by %d, want 1", inc)
+		}
+		if status := update.Lookup("u", "$set", "status").Int32(); status != int32(InProgress) {
+			mt.Fatalf("status saved as %d, want %d", status, InProgress)
+		}
+	})
+
+	mt.Run("versioned", func(mt *mtest.T) {
+		testrunCollection = mt.Coll
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"n", 1}, {"nModified", 1}})
+
+		testRun := TestRun{Id: primitive.NewObjectID(), Version: 3}
+		if err := (mongoTestRunStore{}).SaveTestRun(&testRun); err != nil {
+			mt.Fatal(err)
+		}
+		if testRun.Version != 4 {
+			mt.Fatalf("version is %d, want 4", testRun.Version)
+		}
+
+		filter := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		if version := filter.Lookup("version").Int64(); version != 3 {
+			mt.Fatalf("filter matches version %d, want 3", version)
+		}
+	})
+}
+
+// A save that matches nothing is a conflict if the run is still there and not found otherwise
+func TestMongoTestRunStoreSaveUnmatched(t *testing.T) {
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("conflict", func(mt *mtest.T) {
+		testrunCollection = mt.Coll
+		mt.AddMockResponses(
+			bson.D{{"ok", 1}, {"n", 0}, {"nModified", 0}},
+			mtest.CreateCursorResponse(0, "dstest.testruns", mtest.FirstBatch, bson.D{{"_id", 1}, {"n", 1}}),
+		)
+
+		testRun := TestRun{Id: primitive.NewObjectID(), Version: 2}
+		err := (mongoTestRunStore{}).SaveTestRun(&testRun)
+
+		response, ok := err.(ErrorResponse)
+		if !ok || response.StatusCode != http.StatusConflict {
+			mt.Fatalf("expected a conflict, got %v", err)
+		}
+		if testRun.Version != 2 {
+			mt.Fatalf("version advanced to %d on a conflict", testRun.Version)
+		}
+	})
+
+	mt.Run("missing", func(mt *mtest.T) {
+		testrunCollection = mt.Coll
+		mt.AddMockResponses(
+			bson.D{{"ok", 1}, {"n", 0}, {"nModified", 0}},
+			mtest.CreateCursorResponse(0, "dstest.testruns", mtest.FirstBatch),
+		)
+
+		if err := (mongoTestRunStore{}).SaveTestRun(&TestRun{Id: primitive.NewObjectID()}); err != mongo.ErrNoDocuments {
+			mt.Fatalf("expected mongo.ErrNoDocuments, got %v", err)
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strings"
@@ -22,6 +23,11 @@ func createTestSuite(w http.ResponseWriter, r *http.Request) {
 	// we decode our body request params
 	_ = json.NewDecoder(r.Body).Decode(&testsuite)
 
+	// Certificates record the suite version, so every suite has one
+	if testsuite.Version == 0 {
+		testsuite.Version = 1
+	}
+
 	// Load the test case array for this test
 	testsuite, err := loadTestCases(testsuite, context.TODO())
 
@@ -39,6 +45,96 @@ func createTestSuite(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(testsuite)
 }
 
+// POST /dstestapi/testsuites handler for text/plain bodies
+// Creates the predicates, test cases and suite described by a suite written as text, in the
+// format the summary is printed in
+func createTestSuiteFromText(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		SendError(NewErrorResponse(http.StatusBadRequest, err.Error()), w)
+		return
+	}
+
+	testsuite, err := parseTestSuite(string(body))
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	testsuite, err = insertTestSuite(testsuite)
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(testsuite)
+}
+
+// Insert a fully populated test suite: its predicates, then its test cases, then the suite itself
+func insertTestSuite(testSuite TestSuite) (TestSuite, error) {
+
+	for _, testCase := range testSuite.TestCases {
+
+		if err := insertPredicates(testCase.Predicates); err != nil {
+			return testSuite, err
+		}
+		if testCase.PredicateGroup != nil {
+			if err := insertPredicateGroup(testCase.PredicateGroup); err != nil {
+				return testSuite, err
+			}
+		}
+
+		result, err := testcaseCollection.InsertOne(ctx, testCase)
+		if err != nil {
+			return testSuite, err
+		}
+		testCase.Id = result.InsertedID.(primitive.ObjectID)
+	}
+
+	if testSuite.Version == 0 {
+		testSuite.Version = 1
+	}
+
+	result, err := testsuiteCollection.InsertOne(ctx, testSuite)
+	if err != nil {
+		return testSuite, err
+	}
+	testSuite.Id = result.InsertedID.(primitive.ObjectID)
+
+	return testSuite, nil
+}
+
+func insertPredicates(predicates []*TestCasePredicate) error {
+
+	for _, predicate := range predicates {
+		result, err := predicateCollection.InsertOne(ctx, predicate)
+		if err != nil {
+			return err
+		}
+		predicate.Id = result.InsertedID.(primitive.ObjectID)
+	}
+
+	return nil
+}
+
+func insertPredicateGroup(group *PredicateGroup) error {
+
+	if err := insertPredicates(group.Predicates); err != nil {
+		return err
+	}
+
+	for _, nestedGroup := range group.Groups {
+		if err := insertPredicateGroup(nestedGroup); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // GET /dstestapi/testsuites handler
 func getTestSuites(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -109,16 +205,23 @@ func getTestSuite(w http.ResponseWriter, r *http.Request) {
 	// Load the test case array for this test
 	testsuite, err = loadTestCases(testsuite, context.TODO())
 
-	json.NewEncoder(w).Encode(testsuite)
+	format, err := requestedFormat(r, testSuiteFormats...)
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	writeTestSuite(testsuite, format, w)
 }
 
 // GET /dstestapi/testsuite/{id}/summary handler
+// Served as plain text unless another format is asked for. Asking for JSON still returns the
+// summary as a JSON-encoded string, as it always has.
 func getTestSuiteSummary(w http.ResponseWriter, r *http.Request) {
 	// set header.
 	w.Header().Set("Content-Type", "application/json")
 
 	var testsuite TestSuite
-	var sb strings.Builder
 
 	// we get params with mux.
 	var params = mux.Vars(r)
@@ -139,15 +242,33 @@ func getTestSuiteSummary(w http.ResponseWriter, r *http.Request) {
 	// Load the test case array for this test
 	testsuite, err = loadTestCases(testsuite, context.TODO())
 
-	fmt.Fprintf(&sb, "Test Suite Name: %s\n\n", testsuite.Name)
+	// Text first, so that it remains the default
+	format, err := requestedFormat(r, FormatText, FormatJson, FormatCsv, FormatMarkdown)
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	if format == FormatJson {
+		json.NewEncoder(w).Encode(prettyFormatTestSuite(testsuite))
+		return
+	}
+
+	writeTestSuite(testsuite, format, w)
+}
+
+func prettyFormatTestSuite(testSuite TestSuite) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Test Suite Name: %s\n\n", testSuite.Name)
 
 	// Pretty format all the test cases
-	for _, testCase := range testsuite.TestCases {
+	for _, testCase := range testSuite.TestCases {
 		sb.WriteString(prettyFormatTestCase((*testCase)))
 		sb.WriteString("\n")
 	}
 
-	json.NewEncoder(w).Encode(sb.String())
+	return sb.String()
 }
 
 /*
@@ -164,14 +285,28 @@ func prettyFormatTestCase(testCase TestCase) string {
 
 	fmt.Fprintf(&sb, "Test Case Name: %s\n", testCase.Name)
 	fmt.Fprintf(&sb, "URL: %s\n", testCase.Url)
-	fmt.Fprintf(&sb, "Expected Status Code: %d\n", testCase.ExpectedStatus)
+	if len(testCase.Methods) > 0 {
+		fmt.Fprintf(&sb, "Method: %s\n", strings.Join(testCase.Methods, ", "))
+	}
+	fmt.Fprintf(&sb, "Expected Status Code: %s\n", testCase.ExpectedStatus)
+	if testCase.Optional {
+		fmt.Fprintf(&sb, "Optional: true\n")
+	}
 	fmt.Fprintf(&sb, "Criteria:\n")
 
-	// Pretty format all the predicates
-	for index, predicate := range testCase.Predicates {
-		fmt.Fprintf(&sb, "\t%s == %s", predicate.Attribute, predicate.ExpectedValue)
+	// Pretty format all the predicates, followed by the predicate group if there is one
+	var criteria []string
+	for _, predicate := range testCase.Predicates {
+		criteria = append(criteria, prettyFormatPredicate(predicate))
+	}
+	if testCase.PredicateGroup != nil {
+		criteria = append(criteria, prettyFormatPredicateGroup(testCase.PredicateGroup))
+	}
+
+	for index, criterion := range criteria {
+		fmt.Fprintf(&sb, "\t%s", criterion)
 
-		if index < len(testCase.Predicates)-1 {
+		if index < len(criteria)-1 {
 			fmt.Fprintf(&sb, " AND\n")
 		} else {
 			fmt.Fprintf(&sb, "\n")
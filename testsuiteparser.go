@@ -0,0 +1,392 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Parse a test suite written in the format produced by prettyFormatTestSuite, e.g.
+//
+//	Test Suite Name: Payments
+//
+//	Test Case Name: Authorize a card payment
+//	URL: /ch/payments/v1/charges
+//	Method: POST
+//	Expected Status Code: 201
+//	Criteria:
+//		amount.total == 300 (number) AND
+//		response:status == AUTHORIZED AND
+//		(card.brand == VISA OR card.brand == MASTERCARD)
+//
+// Within a group, predicates come before nested groups, as that is the order they are printed
+// in. Text in this canonical form is printed back identically once the suite has been created.
+func parseTestSuite(text string) (TestSuite, error) {
+
+	parser := testSuiteParser{lines: strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")}
+
+	var testSuite TestSuite
+
+	name, err := parser.field("Test Suite Name")
+	if err != nil {
+		return testSuite, err
+	}
+	testSuite.Name = name
+
+	for {
+		parser.skipBlankLines()
+		if parser.done() {
+			break
+		}
+
+		testCase, err := parser.testCase()
+		if err != nil {
+			return testSuite, err
+		}
+		testSuite.TestCases = append(testSuite.TestCases, testCase)
+	}
+
+	if len(testSuite.TestCases) == 0 {
+		return testSuite, NewErrorResponse(http.StatusBadRequest, "test suite has no test cases")
+	}
+
+	return testSuite, nil
+}
+
+type testSuiteParser struct {
+	lines []string
+	next  int
+}
+
+func (parser *testSuiteParser) done() bool {
+	return parser.next >= len(parser.lines)
+}
+
+func (parser *testSuiteParser) skipBlankLines() {
+	for !parser.done() && strings.TrimSpace(parser.lines[parser.next]) == "" {
+		parser.next++
+	}
+}
+
+// A parse error for the line most recently read
+func (parser *testSuiteParser) errorf(format string, args ...interface{}) error {
+	return NewErrorResponse(http.StatusBadRequest, fmt.Sprintf("line %d: ", parser.next)+fmt.Sprintf(format, args...))
+}
+
+// Whether the next line is the given field
+func (parser *testSuiteParser) hasField(name string) bool {
+	return !parser.done() && strings.HasPrefix(parser.lines[parser.next], name+":")
+}
+
+// Read the next line as `Name: value`
+func (parser *testSuiteParser) field(name string) (string, error) {
+
+	if parser.done() {
+		return "", NewErrorResponse(http.StatusBadRequest, fmt.Sprintf("line %d: expected %s", parser.next+1, name))
+	}
+
+	line := parser.lines[parser.next]
+	parser.next++
+
+	if !strings.HasPrefix(line, name+":") {
+		return "", parser.errorf("expected %s", name)
+	}
+
+	return strings.TrimPrefix(strings.TrimPrefix(line, name+":"), " "), nil
+}
+
+func (parser *testSuiteParser) testCase() (*TestCase, error) {
+
+	testCase := &TestCase{}
+
+	var err error
+	if testCase.Name, err = parser.field("Test Case Name"); err != nil {
+		return nil, err
+	}
+	if testCase.Url, err = parser.field("URL"); err != nil {
+		return nil, err
+	}
+
+	if parser.hasField("Method") {
+		methods, _ := parser.field("Method")
+		for _, method := range strings.Split(methods, ",") {
+			testCase.Methods = append(testCase.Methods, strings.ToUpper(strings.TrimSpace(method)))
+		}
+	}
+
+	expectedStatus, err := parser.field("Expected Status Code")
+	if err != nil {
+		return nil, err
+	}
+	testCase.ExpectedStatus = StatusSpec(expectedStatus)
+	if err := testCase.ExpectedStatus.Validate(); err != nil {
+		return nil, parser.errorf("%s", err.Error())
+	}
+
+	if parser.hasField("Optional") {
+		optional, _ := parser.field("Optional")
+		switch optional {
+		case "true":
+			testCase.Optional = true
+		case "false":
+		default:
+			return nil, parser.errorf("Optional must be true or false")
+		}
+	}
+
+	if _, err := parser.field("Criteria"); err != nil {
+		return nil, err
+	}
+
+	// One criterion per indented line, each but the last ending in AND
+	for !parser.done() && strings.HasPrefix(parser.lines[parser.next], "\t") {
+
+		criterion := strings.TrimPrefix(parser.lines[parser.next], "\t")
+		parser.next++
+
+		isLast := parser.done() || !strings.HasPrefix(parser.lines[parser.next], "\t")
+		if !isLast {
+			if !strings.HasSuffix(criterion, " AND") {
+				return nil, parser.errorf("criteria must be joined with AND")
+			}
+			criterion = strings.TrimSuffix(criterion, " AND")
+		}
+
+		if testCase.PredicateGroup != nil {
+			return nil, parser.errorf("the predicate group must be the last criterion")
+		}
+
+		predicate, group, err := parseCriterion(criterion)
+		if err != nil {
+			return nil, parser.errorf("%s", err.Error())
+		}
+
+		if group != nil {
+			testCase.PredicateGroup = group
+		} else {
+			testCase.Predicates = append(testCase.Predicates, predicate)
+		}
+	}
+
+	if !parser.done() && strings.TrimSpace(parser.lines[parser.next]) != "" {
+		parser.next++
+		return nil, parser.errorf("expected a criterion or a blank line")
+	}
+
+	return testCase, nil
+}
+
+// Parse a criterion, which is either a predicate or a predicate group
+func parseCriterion(criterion string) (*TestCasePredicate, *PredicateGroup, error) {
+
+	if strings.HasPrefix(criterion, "NOT (") || strings.HasPrefix(criterion, "(") {
+		group, err := parsePredicateGroup(criterion)
+		return nil, group, err
+	}
+
+	predicate, err := parsePredicate(criterion)
+	return predicate, nil, err
+}
+
+// Parse a group printed by prettyFormatPredicateGroup, e.g. `(a == 1 OR (b == 2 AND c == 3))`
+func parsePredicateGroup(text string) (*PredicateGroup, error) {
+
+	group := &PredicateGroup{}
+
+	inner := text
+	if strings.HasPrefix(inner, "NOT ") {
+		group.Operator = GroupNot
+		inner = strings.TrimPrefix(inner, "NOT ")
+	}
+
+	if closing := matchingParen(inner, 0); closing != len(inner)-1 {
+		return nil, fmt.Errorf("unbalanced parentheses in %q", text)
+	}
+	inner = inner[1 : len(inner)-1]
+
+	members, operator, err := splitGroupMembers(inner)
+	if err != nil {
+		return nil, fmt.Errorf("%s in %q", err.Error(), text)
+	}
+
+	if group.Operator == GroupNot {
+		if operator == GroupOr {
+			return nil, fmt.Errorf("members of a NOT group are joined with AND in %q", text)
+		}
+	} else {
+		group.Operator = operator
+	}
+
+	for _, member := range members {
+
+		predicate, nestedGroup, err := parseCriterion(member)
+		if err != nil {
+			return nil, err
+		}
+
+		if nestedGroup != nil {
+			group.Groups = append(group.Groups, nestedGroup)
+			continue
+		}
+
+		if len(group.Groups) > 0 {
+			return nil, fmt.Errorf("predicates must come before nested groups in %q", text)
+		}
+		group.Predicates = append(group.Predicates, predicate)
+	}
+
+	return group, validatePredicateGroup(group)
+}
+
+// Split the inside of a group at the ANDs or ORs outside any parentheses. A group must use
+// one of them throughout; a group of one member is an AND.
+func splitGroupMembers(inner string) ([]string, string, error) {
+
+	var members []string
+	operator := ""
+
+	depth, start := 0, 0
+	for i := 0; i < len(inner); i++ {
+		switch inner[i] {
+		case '(':
+			depth++
+			continue
+		case ')':
+			depth--
+			continue
+		}
+
+		if depth != 0 {
+			continue
+		}
+
+		for _, candidate := range []string{GroupAnd, GroupOr} {
+			separator := " " + candidate + " "
+			if !strings.HasPrefix(inner[i:], separator) {
+				continue
+			}
+			if operator != "" && operator != candidate {
+				return nil, "", fmt.Errorf("cannot mix AND and OR in one group")
+			}
+			operator = candidate
+			members = append(members, inner[start:i])
+			i += len(separator) - 1
+			start = i + 1
+			break
+		}
+	}
+
+	if depth != 0 {
+		return nil, "", fmt.Errorf("unbalanced parentheses")
+	}
+
+	members = append(members, inner[start:])
+
+	if operator == "" {
+		operator = GroupAnd
+	}
+
+	return members, operator, nil
+}
+
+// The index of the parenthesis closing the one at open, or -1
+func matchingParen(text string, open int) int {
+
+	depth := 0
+	for i := open; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// Parse a predicate printed by prettyFormatPredicate: `[source:]attribute operator [value] [(type)]`
+func parsePredicate(text string) (*TestCasePredicate, error) {
+
+	predicate := &TestCasePredicate{}
+
+	space := strings.Index(text, " ")
+	if space <= 0 {
+		return nil, fmt.Errorf("expected attribute, operator and value in %q", text)
+	}
+	attribute, rest := text[:space], text[space+1:]
+
+	if colon := strings.Index(attribute, ":"); colon >= 0 {
+		switch source := attribute[:colon]; source {
+		case SourceRequest, SourceResponse, SourceRequestHeader, SourceResponseHeader, SourceQuery:
+			predicate.Source = source
+			attribute = attribute[colon+1:]
+		}
+	}
+	predicate.Attribute = attribute
+
+	symbol := rest
+	if space := strings.Index(rest, " "); space >= 0 {
+		symbol, rest = rest[:space], rest[space+1:]
+	} else {
+		rest = ""
+	}
+	for operator, operatorSymbol := range operatorSymbols {
+		if operatorSymbol == symbol {
+			predicate.Operator = operator
+		}
+	}
+	if predicate.Operator == "" {
+		return nil, fmt.Errorf("unknown operator %q in %q", symbol, text)
+	}
+
+	// What follows the operator, with the space before it
+	if rest != "" || strings.HasSuffix(text, " ") {
+		rest = " " + rest
+	}
+
+	value, expectedType := cutExpectedType(rest)
+
+	switch predicate.Operator {
+	case OpExists, OpNotExists:
+		if value != "" {
+			return nil, fmt.Errorf("%s takes no value in %q", symbol, text)
+		}
+	case OpIn:
+		if !strings.HasPrefix(value, " (") || !strings.HasSuffix(value, ")") {
+			// The apparent type was the list of values
+			value, expectedType = rest, ""
+		}
+		if !strings.HasPrefix(value, " (") || !strings.HasSuffix(value, ")") {
+			return nil, fmt.Errorf("expected a parenthesised list of values in %q", text)
+		}
+		predicate.ExpectedValue = value[2 : len(value)-1]
+	default:
+		predicate.ExpectedValue = strings.TrimPrefix(value, " ")
+	}
+
+	predicate.ExpectedType = expectedType
+	predicate.Name = prettyFormatPredicate(predicate)
+
+	if err := validatePredicate(*predicate); err != nil {
+		return nil, err
+	}
+
+	return predicate, nil
+}
+
+// Separate a trailing ` (type)` from the text after the operator
+func cutExpectedType(rest string) (string, string) {
+
+	for _, expectedType := range []string{TypeString, TypeNumber, TypeBool, TypeNull, TypeObject, TypeArray} {
+		suffix := " (" + expectedType + ")"
+		if strings.HasSuffix(rest, suffix) {
+			return strings.TrimSuffix(rest, suffix), expectedType
+		}
+	}
+
+	return rest, ""
+}
@@ -7,15 +7,19 @@ import (
 )
 
 type Transaction struct {
-	Id        primitive.ObjectID `json:"id,omitempty"`
-	ApiKey    string             `json:"apikey,omitempty" validate:"required"`
-	TestRun   *TestRun           `json:"test_run,omitempty" validate:"required"`
-	Status    int                `json:"status,omitempty" validate:"required"`
-	Url       string             `json:"url,omitempty" validate:"required"`
-	Headers   string             `json:"headers,omitempty" validate:"required"`
-	Request   string             `json:"request,omitempty" validate:"required"`
-	Response  string             `json:"response,omitempty" validate:"required"`
-	Timestamp time.Time          `json:"timestamp,omitempty" validate:"required"`
+	Id              primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	ApiKey          string             `json:"apikey,omitempty" validate:"required"`
+	TestRunId       string             `json:"testrun_id,omitempty" bson:"testrunid" validate:"required"`
+	TestRun         *TestRun           `json:"test_run,omitempty" validate:"required"`
+	Status          int                `json:"status,omitempty" validate:"required"`
+	Method          string             `json:"method,omitempty"`
+	Url             string             `json:"url,omitempty" validate:"required"`
+	Query           string             `json:"query,omitempty"`
+	Headers         string             `json:"headers,omitempty" validate:"required"`
+	Request         string             `json:"request,omitempty" validate:"required"`
+	ResponseHeaders string             `json:"response_headers,omitempty"`
+	Response        string             `json:"response,omitempty" validate:"required"`
+	Timestamp       time.Time          `json:"timestamp,omitempty" validate:"required"`
 }
 
 type TestCasePredicate struct {
@@ -23,19 +27,77 @@ type TestCasePredicate struct {
 	Name          string             `json:"name,omitempty" validate:"required"`
 	Attribute     string             `json:"attribute,omitempty" validate:"required"`
 	ExpectedValue string             `json:"expected_value,omitempty" validate:"required"`
+	Operator      string             `json:"operator,omitempty"`
+	ExpectedType  string             `json:"expected_type,omitempty"`
+	Source        string             `json:"source,omitempty"`
 }
 
+// The part of a transaction a predicate is evaluated against; an empty source means SourceRequest
+const (
+	SourceRequest        = "request"
+	SourceResponse       = "response"
+	SourceRequestHeader  = "request_header"
+	SourceResponseHeader = "response_header"
+	SourceQuery          = "query"
+)
+
+// Predicate operators; an empty operator means OpEquals
+const (
+	OpEquals             = "eq"
+	OpNotEquals          = "ne"
+	OpGreaterThan        = "gt"
+	OpGreaterThanOrEqual = "gte"
+	OpLessThan           = "lt"
+	OpLessThanOrEqual    = "lte"
+	OpRegex              = "regex"
+	OpContains           = "contains"
+	OpStartsWith         = "startsWith"
+	OpIn                 = "in"
+	OpExists             = "exists"
+	OpNotExists          = "notExists"
+)
+
+// JSON types a predicate may declare for strict comparison; an empty type keeps
+// the lenient, case-insensitive comparison of the raw value
+const (
+	TypeString = "string"
+	TypeNumber = "number"
+	TypeBool   = "bool"
+	TypeNull   = "null"
+	TypeObject = "object"
+	TypeArray  = "array"
+)
+
+// A boolean combination of predicates and nested groups. NOT negates the AND of its members.
+type PredicateGroup struct {
+	Operator   string               `json:"operator,omitempty" validate:"required"`
+	Predicates []*TestCasePredicate `json:"predicates,omitempty"`
+	Groups     []*PredicateGroup    `json:"groups,omitempty"`
+}
+
+const (
+	GroupAnd = "AND"
+	GroupOr  = "OR"
+	GroupNot = "NOT"
+)
+
 type TestCase struct {
 	Id             primitive.ObjectID   `json:"_id,omitempty" bson:"_id,omitempty"`
 	Name           string               `json:"name,omitempty" validate:"required"`
 	Url            string               `json:"url,omitempty" validate:"required"`
+	Methods        []string             `json:"methods,omitempty"`
 	Predicates     []*TestCasePredicate `json:"predicates,omitempty" validate:"required"`
-	ExpectedStatus int                  `json:"expected_status,omitempty" validate:"required"`
+	PredicateGroup *PredicateGroup      `json:"predicate_group,omitempty"`
+	ExpectedStatus StatusSpec           `json:"expected_status,omitempty" validate:"required"`
+
+	// Optional test cases need not pass for a run to complete
+	Optional bool `json:"optional,omitempty"`
 }
 
 type TestSuite struct {
 	Id        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	Name      string             `json:"name,omitempty" validate:"required"`
+	Version   int                `json:"version,omitempty"`
 	TestCases []*TestCase        `json:"test_cases,omitempty" validate:"required"`
 }
 
@@ -46,8 +108,26 @@ const (
 	Created
 	InProgress
 	Complete
+	Cancelled
+	Expired
 )
 
+func (status TestRunStatus) String() string {
+	switch status {
+	case Created:
+		return "Created"
+	case InProgress:
+		return "InProgress"
+	case Complete:
+		return "Complete"
+	case Cancelled:
+		return "Cancelled"
+	case Expired:
+		return "Expired"
+	}
+	return "Undefined"
+}
+
 type TestRun struct {
 	Id              primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	Name            string             `json:"name,omitempty" validate:"required"`
@@ -57,6 +137,38 @@ type TestRun struct {
 	TestResults     []*TestResult      `json:"test_results,omitempty" validate:"required"`
 	Status          TestRunStatus      `json:"status,omitempty" validate:"required"`
 	Timestamp       time.Time          `json:"timestamp,omitempty" validate:"required"`
+
+	// After this time an unfinished run expires; no expiry if unset
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// The most recent transaction taken into account by the last evaluation
+	LastTransactionId primitive.ObjectID `json:"last_transaction_id,omitempty"`
+
+	// The transactions already taken into account within TRANSACTION_GRACE_PERIOD of the most recent one
+	RecentTransactionIds []primitive.ObjectID `json:"-"`
+
+	// Set when the run is explicitly reopened; it is not completed again until new transactions arrive
+	Reopened bool `json:"reopened,omitempty"`
+
+	// Incremented on every update; used for optimistic concurrency control
+	Version int64 `json:"version"`
+
+	UnmatchedTransactions []*UnmatchedTransactionGroup `json:"unmatched_transactions,omitempty"`
+}
+
+// A transaction that matched none of the test cases in its run
+type UnmatchedTransaction struct {
+	TransactionId primitive.ObjectID `json:"transaction_id"`
+	Method        string             `json:"method,omitempty"`
+	Status        int                `json:"status"`
+	Timestamp     time.Time          `json:"timestamp"`
+}
+
+// Unmatched transactions that share a URL
+type UnmatchedTransactionGroup struct {
+	Url          string                 `json:"url"`
+	Count        int                    `json:"count"`
+	Transactions []UnmatchedTransaction `json:"transactions"`
 }
 
 type TestStatus int
@@ -68,6 +180,18 @@ const (
 	NotAttempted
 )
 
+func (status TestStatus) String() string {
+	switch status {
+	case Success:
+		return "Success"
+	case Failure:
+		return "Failure"
+	case NotAttempted:
+		return "NotAttempted"
+	}
+	return "Undefined"
+}
+
 type TestResult struct {
 	Id primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	//TestRun     *TestRun           `json:"test_run,omitempty" validate:"required"`
@@ -75,19 +199,219 @@ type TestResult struct {
 	Transaction *Transaction `json:"transaction,omitempty" validate:"required"`
 	Status      TestStatus   `json:"status,omitempty" validate:"required"`
 	Timestamp   time.Time    `json:"timestamp,omitempty" validate:"required"`
+	NearMisses  []NearMiss   `json:"near_misses,omitempty"`
+
+	// Every transaction that matched the test case, oldest first, and statistics derived from them
+	Attempts           []*TestAttempt `json:"attempts,omitempty"`
+	NumAttempts        int            `json:"num_attempts"`
+	FirstPassSuccess   bool           `json:"first_pass_success"`
+	FirstSuccessAt     *time.Time     `json:"first_success_at,omitempty"`
+	TimeToFirstSuccess float64        `json:"time_to_first_success_seconds,omitempty"`
+}
+
+// A transaction that matched a test case on URL, method and predicates
+type TestAttempt struct {
+	TransactionId     primitive.ObjectID `json:"transaction_id"`
+	Status            TestStatus         `json:"status"`
+	TransactionStatus int                `json:"transaction_status"`
+	Timestamp         time.Time          `json:"timestamp"`
+}
+
+// A transaction that hit a NotAttempted test case's URL but did not satisfy all of its criteria
+type NearMiss struct {
+	TransactionId       primitive.ObjectID     `json:"transaction_id"`
+	Method              string                 `json:"method,omitempty"`
+	Url                 string                 `json:"url"`
+	Status              int                    `json:"status"`
+	Timestamp           time.Time              `json:"timestamp"`
+	Score               float64                `json:"score"`
+	MethodMatched       bool                   `json:"method_matched"`
+	NumPredicates       int                    `json:"num_predicates"`
+	NumPredicatesPassed int                    `json:"num_predicates_passed"`
+	FailedPredicates    []PredicateExplanation `json:"failed_predicates,omitempty"`
 }
 
 type TestCaseReport struct {
-	TestCase *TestCase  `json:"test_case,omitempty" validate:"required"`
-	Status   TestStatus `json:"status,omitempty" validate:"required"`
+	TestCase    *TestCase    `json:"test_case,omitempty" validate:"required"`
+	Status      TestStatus   `json:"status,omitempty" validate:"required"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+	NearMisses  []NearMiss   `json:"near_misses,omitempty"`
+
+	Attempts           []*TestAttempt `json:"attempts,omitempty"`
+	NumAttempts        int            `json:"num_attempts"`
+	FirstPassSuccess   bool           `json:"first_pass_success"`
+	FirstSuccessAt     *time.Time     `json:"first_success_at,omitempty"`
+	TimeToFirstSuccess float64        `json:"time_to_first_success_seconds,omitempty"`
 }
 
 type TestRunReport struct {
-	TestSuite         *TestSuite       `json:"test_suite,omitempty" validate:"required"`
-	TestRun           *TestRun         `json:"test_run,omitempty" validate:"required"`
-	Status            TestRunStatus    `json:"status,omitempty" validate:"required"`
-	NumTestCases      int              `json:"num_test_cases,omitempty" validate:"required"`
-	NumTestsAttempted int              `json:"num_tests_attempted,omitempty" validate:"required"`
-	NumTestsPassed    int              `json:"num_tests_passed,omitempty" validate:"required"`
-	TestCaseReports   []TestCaseReport `json:"test_case_reports,omitempty" validate:"required"`
+	EvaluationId      primitive.ObjectID `json:"evaluation_id,omitempty" bson:"-"`
+	TestSuite         *TestSuite         `json:"test_suite,omitempty" validate:"required"`
+	TestRun           *TestRun           `json:"test_run,omitempty" validate:"required"`
+	Status            TestRunStatus      `json:"status,omitempty" validate:"required"`
+	NumTestCases      int                `json:"num_test_cases,omitempty" validate:"required"`
+	NumTestsAttempted int                `json:"num_tests_attempted,omitempty" validate:"required"`
+	NumTestsPassed    int                `json:"num_tests_passed,omitempty" validate:"required"`
+	TestCaseReports   []TestCaseReport   `json:"test_case_reports,omitempty" validate:"required"`
+
+	UnmatchedTransactions []*UnmatchedTransactionGroup `json:"unmatched_transactions,omitempty"`
+}
+
+type TransactionImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type TransactionImportResult struct {
+	NumLines    int                      `json:"num_lines"`
+	NumInserted int                      `json:"num_inserted"`
+	NumFailed   int                      `json:"num_failed"`
+	Errors      []TransactionImportError `json:"errors,omitempty"`
+
+	// Set when the import stopped early. Lines before FatalLine were fully processed as
+	// reported above; FatalLine and everything after it may need to be submitted again.
+	FatalError string `json:"fatal_error,omitempty"`
+	FatalLine  int    `json:"fatal_line,omitempty"`
+}
+
+// How a transaction fared against a criterion. Group is the label of the predicate group the
+// criterion belongs to, empty for top level criteria. Predicate groups are explained as a whole
+// by an entry with IsGroup set, whose Path is the label carried by its members; members are
+// listed for information, and only the group's own result counts towards the test case.
+type PredicateExplanation struct {
+	Predicate string `json:"predicate"`
+	Group     string `json:"group,omitempty"`
+	IsGroup   bool   `json:"is_group,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Source    string `json:"source"`
+	Attribute string `json:"attribute"`
+	Operator  string `json:"operator"`
+	Expected  string `json:"expected,omitempty"`
+	Actual    string `json:"actual,omitempty"`
+	Found     bool   `json:"found"`
+	Passed    bool   `json:"passed"`
+}
+
+// Matching steps, in the order they are applied
+const (
+	StepUrl        = "url"
+	StepMethod     = "method"
+	StepPredicates = "predicates"
+	StepStatus     = "status"
+)
+
+type TransactionExplanation struct {
+	TransactionId     primitive.ObjectID     `json:"transaction_id"`
+	Method            string                 `json:"method,omitempty"`
+	Url               string                 `json:"url"`
+	Status            int                    `json:"status"`
+	Timestamp         time.Time              `json:"timestamp"`
+	UrlMatched        bool                   `json:"url_matched"`
+	MethodMatched     bool                   `json:"method_matched"`
+	PredicatesMatched bool                   `json:"predicates_matched"`
+	Predicates        []PredicateExplanation `json:"predicates"`
+	StatusMatched     bool                   `json:"status_matched"`
+	ExpectedStatus    StatusSpec             `json:"expected_status"`
+	FailedStep        string                 `json:"failed_step,omitempty"`
+}
+
+type TestCaseExplanation struct {
+	TestRunId    primitive.ObjectID       `json:"test_run_id"`
+	TestCase     *TestCase                `json:"test_case"`
+	Status       TestStatus               `json:"status"`
+	Transactions []TransactionExplanation `json:"transactions"`
+}
+
+// An immutable snapshot of the report produced by evaluating a test run
+type TestRunEvaluation struct {
+	Id        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	TestRunId primitive.ObjectID `json:"test_run_id,omitempty" validate:"required"`
+	Report    *TestRunReport     `json:"report,omitempty" validate:"required"`
+	Timestamp time.Time          `json:"timestamp,omitempty" validate:"required"`
+}
+
+// Events a webhook subscription can receive
+const (
+	WebhookRunCompleted   = "run.completed"
+	WebhookRunExpired     = "run.expired"
+	WebhookTestCasePassed = "testcase.passed"
+	WebhookTestCaseFailed = "testcase.failed"
+)
+
+// A callback URL notified of test run events. Subscriptions without an api key receive events
+// for every run; subscriptions without events receive every event.
+type WebhookSubscription struct {
+	Id        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	ApiKey    string             `json:"apikey,omitempty"`
+	Url       string             `json:"url,omitempty" validate:"required"`
+	Secret    string             `json:"secret,omitempty"`
+	Events    []string           `json:"events,omitempty"`
+	Timestamp time.Time          `json:"timestamp,omitempty"`
+}
+
+// The JSON body sent to a webhook
+type WebhookPayload struct {
+	DeliveryId primitive.ObjectID `json:"delivery_id"`
+	Event      string             `json:"event"`
+	Timestamp  time.Time          `json:"timestamp"`
+	TestRunId  primitive.ObjectID `json:"test_run_id"`
+	ApiKey     string             `json:"apikey,omitempty"`
+	RunStatus  TestRunStatus      `json:"run_status,omitempty"`
+	TestCase   *TestCase          `json:"test_case,omitempty"`
+	TestStatus TestStatus         `json:"test_status,omitempty"`
+}
+
+type WebhookDeliveryAttempt struct {
+	Timestamp  time.Time `json:"timestamp"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// A single event sent to a subscription, with the outcome of every attempt to deliver it
+type WebhookDelivery struct {
+	Id             primitive.ObjectID       `json:"_id,omitempty" bson:"_id,omitempty"`
+	SubscriptionId primitive.ObjectID       `json:"subscription_id"`
+	Event          string                   `json:"event"`
+	TestRunId      primitive.ObjectID       `json:"test_run_id"`
+	Payload        string                   `json:"payload"`
+	Delivered      bool                     `json:"delivered"`
+	Attempts       []WebhookDeliveryAttempt `json:"attempts"`
+	Timestamp      time.Time                `json:"timestamp"`
+}
+
+// What a certificate attests to: that the test run passed every test case in this version of the suite
+type CertificateClaims struct {
+	TestRunId        primitive.ObjectID `json:"test_run_id"`
+	TestRunName      string             `json:"test_run_name,omitempty"`
+	TestSuiteId      primitive.ObjectID `json:"test_suite_id"`
+	TestSuiteName    string             `json:"test_suite_name,omitempty"`
+	TestSuiteVersion int                `json:"test_suite_version"`
+	ResultsDigest    string             `json:"results_digest"`
+	ApiKey           string             `json:"apikey"`
+	NumTestCases     int                `json:"num_test_cases"`
+	NumTestsPassed   int                `json:"num_tests_passed"`
+	IssuedAt         time.Time          `json:"issued_at"`
+}
+
+// A certification issued when a test run completes with every test case passed. The signature is
+// an Ed25519 signature over the bytes of Payload, which is the base64url encoded JSON of Claims.
+type Certificate struct {
+	Id        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Claims    CertificateClaims  `json:"claims"`
+	Payload   string             `json:"payload"`
+	Algorithm string             `json:"algorithm"`
+	KeyId     string             `json:"key_id"`
+	Signature string             `json:"signature"`
+}
+
+type CertificateVerification struct {
+	Valid  bool               `json:"valid"`
+	Reason string             `json:"reason,omitempty"`
+	Claims *CertificateClaims `json:"claims,omitempty"`
+}
+
+type CertificatePublicKey struct {
+	Algorithm string `json:"algorithm"`
+	KeyId     string `json:"key_id"`
+	PublicKey string `json:"public_key"`
 }
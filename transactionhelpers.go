@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Check that the supplied transaction has the shape the collector expects
+func validateTransaction(transaction Transaction) error {
+
+	if transaction.TestRunId == "" {
+		return NewErrorResponse(http.StatusBadRequest, "testrun_id is required")
+	}
+
+	if transaction.ApiKey == "" {
+		return NewErrorResponse(http.StatusBadRequest, "apikey is required")
+	}
+
+	if !strings.HasPrefix(transaction.Url, "/") {
+		return NewErrorResponse(http.StatusBadRequest, "url is required and must be a path starting with /")
+	}
+
+	if strings.ContainsAny(transaction.Method, " /?") {
+		return NewErrorResponse(http.StatusBadRequest, "method must be an HTTP method such as GET or POST")
+	}
+
+	if transaction.Status < 100 || transaction.Status > 599 {
+		return NewErrorResponse(http.StatusBadRequest, "status must be a valid HTTP status code")
+	}
+
+	// Predicates are evaluated with gjson, so any bodies supplied must be valid JSON
+	if transaction.Request != "" && !gjson.Valid(transaction.Request) {
+		return NewErrorResponse(http.StatusBadRequest, "request must be valid JSON")
+	}
+
+	if transaction.Response != "" && !gjson.Valid(transaction.Response) {
+		return NewErrorResponse(http.StatusBadRequest, "response must be valid JSON")
+	}
+
+	if transaction.Headers != "" && !gjson.Valid(transaction.Headers) {
+		return NewErrorResponse(http.StatusBadRequest, "headers must be valid JSON")
+	}
+
+	if transaction.ResponseHeaders != "" && !gjson.Valid(transaction.ResponseHeaders) {
+		return NewErrorResponse(http.StatusBadRequest, "response_headers must be valid JSON")
+	}
+
+	return nil
+}
+
+// Bind the transaction to the TestRun referenced by its test run header id, checking that the
+// api key matches the run. TestRuns already looked up are kept in testRuns to save round trips.
+func bindTransactionToTestRun(transaction *Transaction, testRuns map[string]TestRun, ctx context.Context) error {
+
+	testRun, ok := testRuns[transaction.TestRunId]
+	if !ok {
+		var err error
+		testRun, err = getTestRunByHeaderId(transaction.TestRunId, ctx)
+
+		if err == mongo.ErrNoDocuments {
+			return NewErrorResponse(http.StatusNotFound, "no test run found for testrun_id "+transaction.TestRunId)
+		} else if err != nil {
+			return err
+		}
+
+		testRuns[transaction.TestRunId] = testRun
+	}
+
+	if testRun.ApiKey != transaction.ApiKey {
+		return NewErrorResponse(http.StatusForbidden, "apikey does not match test run "+transaction.TestRunId)
+	}
+
+	if !acceptsTransactions(testRun, time.Now()) {
+		return NewErrorResponse(http.StatusConflict, "test run "+transaction.TestRunId+" is no longer accepting transactions")
+	}
+
+	// The run is referenced by header id; don't embed the run document itself
+	transaction.TestRun = nil
+
+	// Methods are matched case-insensitively, but store them in their usual form
+	transaction.Method = strings.ToUpper(transaction.Method)
+
+	// Timestamps are always assigned by the server
+	transaction.Timestamp = time.Now()
+
+	return nil
+}
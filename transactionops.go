@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Number of NDJSON lines inserted per round trip when importing transactions
+const IMPORT_BATCH_SIZE = 500
+
+// POST /dstestapi/transactions handler
+// Accepts either a single transaction object or an array of transactions
+func createTransactions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		SendError(NewErrorResponse(http.StatusBadRequest, err.Error()), w)
+		return
+	}
+
+	// A batch is a JSON array; anything else is treated as a single transaction
+	isBatch := bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+
+	var transactions []Transaction
+	if isBatch {
+		err = json.Unmarshal(body, &transactions)
+	} else {
+		var transaction Transaction
+		err = json.Unmarshal(body, &transaction)
+		transactions = append(transactions, transaction)
+	}
+
+	if err != nil {
+		SendError(NewErrorResponse(http.StatusBadRequest, "invalid transaction JSON: "+err.Error()), w)
+		return
+	}
+
+	if len(transactions) == 0 {
+		SendError(NewErrorResponse(http.StatusBadRequest, "no transactions supplied"), w)
+		return
+	}
+
+	// Validate and bind every transaction before inserting any of them
+	testRuns := make(map[string]TestRun)
+	for i := range transactions {
+
+		err = validateTransaction(transactions[i])
+		if err == nil {
+			err = bindTransactionToTestRun(&transactions[i], testRuns, ctx)
+		}
+
+		if err != nil {
+			if response, ok := err.(ErrorResponse); ok && isBatch {
+				response.ErrorMessage = fmt.Sprintf("transaction %d: %s", i, response.ErrorMessage)
+				err = response
+			}
+			SendError(err, w)
+			return
+		}
+	}
+
+	documents := make([]interface{}, len(transactions))
+	for i, transaction := range transactions {
+		documents[i] = transaction
+	}
+
+	result, err := txCollection.InsertMany(ctx, documents)
+
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	// Return the insertedIds as the Ids for the newly created transactions
+	for i, insertedId := range result.InsertedIDs {
+		transactions[i].Id = insertedId.(primitive.ObjectID)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+
+	if isBatch {
+		json.NewEncoder(w).Encode(transactions)
+	} else {
+		json.NewEncoder(w).Encode(transactions[0])
+	}
+}
+
+// POST /dstestapi/transactions/import handler
+// Streams newline-delimited JSON transactions from the body, inserting them in batches
+func importTransactions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var result TransactionImportResult
+
+	testRuns := make(map[string]TestRun)
+	reader := bufio.NewReader(r.Body)
+
+	// The transactions waiting to be inserted, and the body line each one came from
+	var batch []interface{}
+	var batchLines []int
+
+	lineNumber := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			// Nothing from the unread line or the batch waiting to be inserted was stored
+			fatalLine := lineNumber + 1
+			if len(batchLines) > 0 {
+				fatalLine = batchLines[0]
+			}
+			sendImportFailure(&result, fatalLine, NewErrorResponse(http.StatusBadRequest, err.Error()), w)
+			return
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			lineNumber++
+			result.NumLines++
+
+			transaction, lineErr := parseImportLine(line, testRuns)
+			if lineErr != nil {
+				result.addError(lineNumber, lineErr)
+			} else {
+				batch = append(batch, transaction)
+				batchLines = append(batchLines, lineNumber)
+			}
+		} else if err == nil {
+			// Blank lines are skipped but still count towards line numbers
+			lineNumber++
+		}
+
+		if len(batch) == IMPORT_BATCH_SIZE || (err == io.EOF && len(batch) > 0) {
+			if insertErr := insertImportBatch(batch, batchLines, &result); insertErr != nil {
+				sendImportFailure(&result, batchLines[0], insertErr, w)
+				return
+			}
+			batch = nil
+			batchLines = nil
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// Decode, validate and bind a single NDJSON line
+func parseImportLine(line []byte, testRuns map[string]TestRun) (Transaction, error) {
+
+	var transaction Transaction
+
+	if err := json.Unmarshal(line, &transaction); err != nil {
+		return transaction, NewErrorResponse(http.StatusBadRequest, "invalid transaction JSON: "+err.Error())
+	}
+
+	if err := validateTransaction(transaction); err != nil {
+		return transaction, err
+	}
+
+	if err := bindTransactionToTestRun(&transaction, testRuns, ctx); err != nil {
+		return transaction, err
+	}
+
+	return transaction, nil
+}
+
+// Report an import that stopped part way through, along with how far it got, so the client can resubmit from the line that failed
+func sendImportFailure(result *TransactionImportResult, fatalLine int, err error, w http.ResponseWriter) {
+
+	status := http.StatusInternalServerError
+	if response, ok := err.(ErrorResponse); ok {
+		status = response.StatusCode
+	} else {
+		log.Println(err.Error())
+	}
+
+	result.FatalError = err.Error()
+	result.FatalLine = fatalLine
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// Insert a batch of imported transactions, recording any per-document failures against their lines.
+// Only errors that prevent the batch from being written at all are returned.
+func insertImportBatch(batch []interface{}, batchLines []int, result *TransactionImportResult) error {
+
+	// Unordered so that one bad document does not stop the rest of the batch
+	_, err := txCollection.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+
+	if bulkErr, ok := err.(mongo.BulkWriteException); ok {
+		for _, writeErr := range bulkErr.WriteErrors {
+			result.addError(batchLines[writeErr.Index], writeErr)
+		}
+		result.NumInserted += len(batch) - len(bulkErr.WriteErrors)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	result.NumInserted += len(batch)
+	return nil
+}
+
+// Record a failure for the given line of the import
+func (result *TransactionImportResult) addError(line int, err error) {
+	result.NumFailed++
+	result.Errors = append(result.Errors, TransactionImportError{Line: line, Message: err.Error()})
+}
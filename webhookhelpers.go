@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Header carrying the hex HMAC-SHA256 of the body, keyed with the subscription secret
+const WEBHOOK_SIGNATURE_HEADER = "X-Dstest-Signature"
+const WEBHOOK_EVENT_HEADER = "X-Dstest-Event"
+const WEBHOOK_DELIVERY_HEADER = "X-Dstest-Delivery"
+
+// Deliveries are attempted this many times, waiting twice as long after each failure
+const WEBHOOK_MAX_ATTEMPTS = 5
+const WEBHOOK_INITIAL_BACKOFF = 2 * time.Second
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// The webhook event a test run event corresponds to, if any
+func webhookEventFor(event TestRunEvent) string {
+
+	switch event.Type {
+	case EventResult:
+		switch event.TestStatus {
+		case Success:
+			return WebhookTestCasePassed
+		case Failure:
+			return WebhookTestCaseFailed
+		}
+	case EventStatus:
+		switch event.RunStatus {
+		case Complete:
+			return WebhookRunCompleted
+		case Expired:
+			return WebhookRunExpired
+		}
+	}
+
+	return ""
+}
+
+// Record and send a delivery to every subscription interested in the test run event
+func triggerWebhooks(testRun TestRun, event TestRunEvent) {
+
+	webhookEvent := webhookEventFor(event)
+	if webhookEvent == "" {
+		return
+	}
+
+	filter := bson.M{
+		"apikey": bson.M{"$in": bson.A{"", nil, testRun.ApiKey}},
+		"$or": bson.A{
+			bson.M{"events": bson.M{"$size": 0}},
+			bson.M{"events": nil},
+			bson.M{"events": webhookEvent},
+		},
+	}
+
+	var subscriptions []WebhookSubscription
+	cursor, err := webhookCollection.Find(ctx, filter)
+	if err == nil {
+		err = cursor.All(ctx, &subscriptions)
+	}
+	if err != nil {
+		log.Println("Could not find webhook subscriptions:", err.Error())
+		return
+	}
+
+	for _, subscription := range subscriptions {
+
+		delivery := WebhookDelivery{
+			Id:             primitive.NewObjectID(),
+			SubscriptionId: subscription.Id,
+			Event:          webhookEvent,
+			TestRunId:      testRun.Id,
+			Attempts:       []WebhookDeliveryAttempt{},
+			Timestamp:      time.Now(),
+		}
+
+		payload, _ := json.Marshal(WebhookPayload{
+			DeliveryId: delivery.Id,
+			Event:      webhookEvent,
+			Timestamp:  event.Timestamp,
+			TestRunId:  testRun.Id,
+			ApiKey:     testRun.ApiKey,
+			RunStatus:  testRun.Status,
+			TestCase:   event.TestCase,
+			TestStatus: event.TestStatus,
+		})
+		delivery.Payload = string(payload)
+
+		if _, err := webhookDeliveryCollection.InsertOne(ctx, delivery); err != nil {
+			log.Println("Could not record webhook delivery:", err.Error())
+			continue
+		}
+
+		go deliverWebhook(subscription, delivery)
+	}
+}
+
+// Sign the payload with the subscription secret
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Generate a secret for subscriptions created without one
+func generateWebhookSecret() string {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return hex.EncodeToString(secret)
+}
+
+// POST the delivery's payload to the subscription, retrying with exponential backoff until it is
+// accepted or the attempts run out. Every attempt is recorded on the delivery.
+func deliverWebhook(subscription WebhookSubscription, delivery WebhookDelivery) {
+
+	backoff := WEBHOOK_INITIAL_BACKOFF
+
+	for attempt := 1; attempt <= WEBHOOK_MAX_ATTEMPTS; attempt++ {
+
+		result := sendWebhook(subscription, delivery)
+		delivered := result.Error == "" && result.StatusCode >= 200 && result.StatusCode < 300
+
+		update := bson.M{
+			"$push": bson.M{"attempts": result},
+			"$set":  bson.M{"delivered": delivered},
+		}
+		if _, err := webhookDeliveryCollection.UpdateOne(ctx, bson.M{"_id": delivery.Id}, update); err != nil {
+			log.Println("Could not record webhook delivery attempt:", err.Error())
+		}
+
+		if delivered {
+			return
+		}
+
+		if attempt < WEBHOOK_MAX_ATTEMPTS {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+// Make a single attempt at delivering the payload
+func sendWebhook(subscription WebhookSubscription, delivery WebhookDelivery) WebhookDeliveryAttempt {
+
+	result := WebhookDeliveryAttempt{Timestamp: time.Now()}
+
+	payload := []byte(delivery.Payload)
+
+	request, err := http.NewRequest("POST", subscription.Url, bytes.NewReader(payload))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WEBHOOK_EVENT_HEADER, delivery.Event)
+	request.Header.Set(WEBHOOK_DELIVERY_HEADER, delivery.Id.Hex())
+	request.Header.Set(WEBHOOK_SIGNATURE_HEADER, signWebhookPayload(subscription.Secret, payload))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	response.Body.Close()
+
+	result.StatusCode = response.StatusCode
+	return result
+}
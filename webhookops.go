@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// POST /dstestapi/webhooks handler
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var subscription WebhookSubscription
+
+	// we decode our body request params
+	_ = json.NewDecoder(r.Body).Decode(&subscription)
+
+	callbackUrl, err := url.Parse(subscription.Url)
+	if err != nil || (callbackUrl.Scheme != "http" && callbackUrl.Scheme != "https") || callbackUrl.Host == "" {
+		SendError(NewErrorResponse(http.StatusBadRequest, "url must be an absolute http or https URL"), w)
+		return
+	}
+
+	for _, event := range subscription.Events {
+		switch event {
+		case WebhookRunCompleted, WebhookRunExpired, WebhookTestCasePassed, WebhookTestCaseFailed:
+		default:
+			SendError(NewErrorResponse(http.StatusBadRequest, "unknown webhook event "+event), w)
+			return
+		}
+	}
+
+	// The secret is only ever returned here, so generate one if the caller didn't supply it
+	if subscription.Secret == "" {
+		subscription.Secret = generateWebhookSecret()
+	}
+	subscription.Timestamp = time.Now()
+
+	// insert our object
+	result, err := webhookCollection.InsertOne(ctx, subscription)
+
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	// Return the insertedId as the Id for this newly created subscription
+	subscription.Id = result.InsertedID.(primitive.ObjectID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// GET /dstestapi/webhooks handler
+func getWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Check whether params were passed; set filter accordingly
+	filter := bson.M{}
+	apiKey := r.URL.Query().Get("apikey")
+	if apiKey != "" {
+		filter = bson.M{"apikey": apiKey}
+	}
+
+	subscriptions := []WebhookSubscription{}
+
+	cur, err := webhookCollection.Find(ctx, filter)
+	if err == nil {
+		err = cur.All(ctx, &subscriptions)
+	}
+
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	// Secrets are never listed
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+// GET /dstestapi/webhooks/{id} handler
+func getWebhook(w http.ResponseWriter, r *http.Request) {
+	// set header.
+	w.Header().Set("Content-Type", "application/json")
+
+	// we get params with mux.
+	var params = mux.Vars(r)
+
+	subscription, err := getWebhookById(params["id"])
+
+	if err != nil {
+		//TODO assumption here is that the error is `not found`
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	subscription.Secret = ""
+
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// DELETE /dstestapi/webhooks/{id} handler
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	// Set header
+	w.Header().Set("Content-Type", "application/json")
+
+	// get params
+	var params = mux.Vars(r)
+
+	// string to primitve.ObjectID
+	id, _ := primitive.ObjectIDFromHex(params["id"])
+
+	deleteResult, err := webhookCollection.DeleteOne(ctx, bson.M{"_id": id})
+
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(deleteResult)
+}
+
+// GET /dstestapi/webhooks/{id}/deliveries handler
+func getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// get params
+	var params = mux.Vars(r)
+
+	// string to primitve.ObjectID
+	id, _ := primitive.ObjectIDFromHex(params["id"])
+
+	// Most recent first
+	findOptions := options.Find()
+	findOptions.SetSort(bson.M{"_id": -1})
+
+	deliveries := []WebhookDelivery{}
+
+	cur, err := webhookDeliveryCollection.Find(ctx, bson.M{"subscriptionid": id}, findOptions)
+	if err == nil {
+		err = cur.All(ctx, &deliveries)
+	}
+
+	if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// POST /dstestapi/webhooks/deliveries/{id}/replay handler
+// Sends the delivery's original payload again, recording the new attempts on the same delivery
+func replayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// get params
+	var params = mux.Vars(r)
+
+	// string to primitve.ObjectID
+	id, _ := primitive.ObjectIDFromHex(params["id"])
+
+	var delivery WebhookDelivery
+	err := webhookDeliveryCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&delivery)
+
+	if err != nil {
+		//TODO assumption here is that the error is `not found`
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	subscription, err := getWebhookById(delivery.SubscriptionId.Hex())
+
+	if err == mongo.ErrNoDocuments {
+		SendError(NewErrorResponse(http.StatusGone, "webhook subscription no longer exists"), w)
+		return
+	} else if err != nil {
+		SendError(err, w)
+		return
+	}
+
+	go deliverWebhook(subscription, delivery)
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// Fetch the webhook subscription with the specified id
+func getWebhookById(webhookId string) (WebhookSubscription, error) {
+
+	var subscription WebhookSubscription
+
+	// string to primitive.ObjectID
+	id, _ := primitive.ObjectIDFromHex(webhookId)
+
+	err := webhookCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&subscription)
+
+	return subscription, err
+}